@@ -0,0 +1,98 @@
+package senml_test
+
+import (
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+// benchPack returns a pack like a gateway forwards: 33 samples of each of
+// three series, compacted into base fields
+func benchPack(b *testing.B) senml.SenML {
+	packs, err := senml.Generate(senml.GenerateOptions{
+		Devices:     1,
+		Start:       1600000000,
+		PackSamples: 33,
+		Compact:     true,
+		Seed:        1,
+	}, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return packs[0]
+}
+
+var benchFormats = []senml.Format{senml.JSON, senml.XML, senml.CBOR, senml.CSV, senml.MPACK, senml.LINEP, senml.JSONLINE, senml.TABLE, senml.CBORDIAG, senml.CBORHEX}
+
+func BenchmarkEncode(b *testing.B) {
+	s := benchPack(b)
+	for _, format := range benchFormats {
+		b.Run(format.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := senml.Encode(s, format, senml.OutputOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	s := benchPack(b)
+	for _, format := range benchFormats {
+		if format == senml.CSV || format == senml.LINEP || format == senml.TABLE {
+			// these are output only
+			continue
+		}
+		data, err := senml.Encode(s, format, senml.OutputOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(format.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_, err := senml.Decode(data, format)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	s := benchPack(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		senml.Normalize(s)
+	}
+}
+
+// BenchmarkCodecParallel is a server sharing one Codec between the
+// goroutines decoding and encoding its requests
+func BenchmarkCodecParallel(b *testing.B) {
+	c, err := senml.NewCodec(senml.CodecOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := c.Encode(benchPack(b), senml.CBOR, senml.OutputOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s, err := c.Decode(data, senml.CBOR)
+			if err == nil {
+				_, err = c.Encode(s, senml.JSON, senml.OutputOptions{})
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cisco/senml"
+)
+
+// formatExtensions are the file extensions given to files written by -r
+var formatExtensions = map[senml.Format]string{
+	senml.JSON:     ".json",
+	senml.XML:      ".xml",
+	senml.CBOR:     ".cbor",
+	senml.CSV:      ".csv",
+	senml.MPACK:    ".mpack",
+	senml.LINEP:    ".linp",
+	senml.JSONLINE: ".jsonl",
+	senml.TABLE:    ".txt",
+	senml.CBORDIAG: ".diag",
+	senml.CBORHEX:  ".hex",
+}
+
+// batchOutputs remembers which file each output of a batch was written from,
+// so two files such as x.json and x.xml do not both write x.cbor
+type batchOutputs struct {
+	mutex sync.Mutex
+	from  map[string]string
+}
+
+// claim reserves out for path, or returns the file that already has it
+func (o *batchOutputs) claim(out string, path string) (string, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if other, ok := o.from[out]; ok {
+		return other, false
+	}
+	o.from[out] = path
+	return path, true
+}
+
+// batchResult is what happened to one file of a batch
+type batchResult struct {
+	path    string
+	skipped bool
+	err     error
+}
+
+// convertTree converts each SenML file under inDir into outDir, keeping the
+// relative paths, with a pool of workers. Files whose format is not known
+// from the name or the content are skipped. A file that fails, or that would
+// write over the output of another file, is reported and the batch goes on.
+func convertTree(inDir string, outDir string) error {
+	var format senml.Format = senml.JSON
+	if outFormat != 0 {
+		format = outFormat
+	}
+	if *signKeyFile != "" || *macKeyFile != "" {
+		format = senml.CBOR
+	}
+
+	// leave out the files written when outDir is under inDir
+	skipDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(inDir); err == nil && abs == skipDir {
+		return errors.New("-r needs an output directory apart from the input directory")
+	}
+	outputs := &batchOutputs{from: map[string]string{}}
+
+	paths := make(chan string)
+	results := make(chan batchResult)
+
+	var wg sync.WaitGroup
+	workers := *batchWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				results <- convertOne(inDir, outDir, path, format, outputs)
+			}
+		}()
+	}
+
+	var walkErr error
+	go func() {
+		walkErr = filepath.Walk(inDir, func(path string, info os.FileInfo, err error) error {
+			switch {
+			case err != nil:
+				results <- batchResult{path: path, err: err}
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+			case info.IsDir():
+				if abs, _ := filepath.Abs(path); abs == skipDir {
+					return filepath.SkipDir
+				}
+			case info.Mode().IsRegular():
+				paths <- path
+			}
+			return nil
+		})
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+
+	converted, skipped, failed := 0, 0, 0
+	for result := range results {
+		switch {
+		case result.err != nil:
+			failed += 1
+			fmt.Fprintf(os.Stderr, "%s: %v\n", result.path, result.err)
+		case result.skipped:
+			skipped += 1
+		default:
+			converted += 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "converted %d files, %d failed, %d skipped as not SenML\n", converted, failed, skipped)
+
+	if walkErr != nil {
+		return walkErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be converted", failed)
+	}
+	return nil
+}
+
+// convertOne converts one file of a batch
+func convertOne(inDir string, outDir string, path string, format senml.Format, outputs *batchOutputs) batchResult {
+	result := batchResult{path: path}
+
+	rel, err := filepath.Rel(inDir, path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	msg, err := ioutil.ReadFile(path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	fileFormat, ok := batchFormat(path, msg)
+	if !ok {
+		result.skipped = true
+		return result
+	}
+	s, err := decodeFileAs(path, msg, fileFormat)
+	if err != nil {
+		result.err = err
+		if inner := errors.Unwrap(err); inner != nil {
+			result.err = inner
+		}
+		return result
+	}
+	data, err := encodeData(s)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	out := filepath.Join(outDir, strings.TrimSuffix(rel, filepath.Ext(rel))+formatExtensions[format])
+	if other, ok := outputs.claim(out, path); !ok {
+		result.err = fmt.Errorf("%s is also written from %s", out, other)
+		return result
+	}
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(out, data, 0644)
+	}
+	result.err = err
+	return result
+}
+
+// batchFormat returns the input format of a file in a batch: the one chosen,
+// or else the one its name or content suggests
+func batchFormat(path string, msg []byte) (senml.Format, bool) {
+	if *verifyKeyFile != "" || inFormat != 0 {
+		return inputFormat(path), true
+	}
+	if format, ok := senml.FormatForFile(path); ok {
+		return format, true
+	}
+	return senml.DetectFormat(msg)
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cisco/senml"
+)
+
+// command is a senmlCat subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	// from and to tell if the command takes --from and --to
+	from bool
+	to   bool
+	// flags names the flags shared with the commandless form
+	flags []string
+	// extra adds the flags only this command has
+	extra func(fs *flag.FlagSet)
+	run   func(names []string) error
+}
+
+var decodeFlags = []string{"verify", "lenient", "strict", "skipbad"}
+var outputFlags = []string{"i", "o", "print", "post", "topic", "sign", "mac", "kid"}
+var transformFlags = []string{"resolve", "pipeline", "pipelinefile", "where", "compact"}
+
+func join(lists ...[]string) []string {
+	var ret []string
+	for _, l := range lists {
+		ret = append(ret, l...)
+	}
+	return ret
+}
+
+var httpPort *int
+
+// maxBytes and maxRecords limit what serve decodes, with 0 for no limit
+var maxBytes = new(int)
+var maxRecords = new(int)
+var doWarnPtr *bool
+var reportFormat *string
+
+var commands = []*command{
+	{
+		name:    "convert",
+		args:    "[file...]",
+		summary: "convert SenML between formats, merging several files",
+		from:    true,
+		to:      true,
+		flags:   join(decodeFlags, outputFlags, transformFlags, []string{"stream", "follow", "offsetfile", "poll", "r", "j"}),
+		run:     convertFiles,
+	},
+	{
+		name:    "validate",
+		args:    "[file...]",
+		summary: "check that each file holds valid SenML",
+		from:    true,
+		flags:   join(decodeFlags, []string{"o"}),
+		extra: func(fs *flag.FlagSet) {
+			doWarnPtr = fs.Bool("warn", false, "also report style problems: no base name, units not registered and times in the future")
+			reportFormat = fs.String("report", "text", "write the report as text or json")
+		},
+		run: validateFiles,
+	},
+	{
+		name:    "normalize",
+		args:    "[file...]",
+		summary: "resolve the base fields into every record",
+		from:    true,
+		to:      true,
+		flags:   join(decodeFlags, outputFlags, []string{"pipeline", "pipelinefile", "where", "stream"}),
+		run: func(names []string) error {
+			*doResolvePtr = true
+			return convertFiles(names)
+		},
+	},
+	{
+		name:    "compact",
+		args:    "[file...]",
+		summary: "move common names, times and units into base fields",
+		from:    true,
+		to:      true,
+		flags:   join(decodeFlags, outputFlags, []string{"pipeline", "pipelinefile", "where"}),
+		run: func(names []string) error {
+			*doCompactPtr = true
+			return convertFiles(names)
+		},
+	},
+	{
+		name:    "stats",
+		args:    "[file...]",
+		summary: "summarize the records of the files and their size in each format",
+		from:    true,
+		flags:   join(decodeFlags, []string{"o", "pipeline", "pipelinefile", "where", "stream"}),
+		run:     statsFiles,
+	},
+	{
+		name:    "diff",
+		args:    "old new",
+		summary: "list the records that differ, exiting with 1 if any do",
+		from:    true,
+		flags:   join(decodeFlags, []string{"o"}),
+		run:     diffFiles,
+	},
+	{
+		name:    "explore",
+		args:    "file...",
+		summary: "browse the records in a terminal, with a sparkline of each series",
+		from:    true,
+		flags:   join(decodeFlags, []string{"pipeline", "pipelinefile", "where"}),
+		run:     exploreFiles,
+	},
+	{
+		name:    "serve",
+		summary: "convert SenML posted over HTTP and write or post it on",
+		from:    true,
+		to:      true,
+		flags:   join(decodeFlags, outputFlags, transformFlags),
+		extra: func(fs *flag.FlagSet) {
+			httpPort = fs.Int("http", 8880, "port to listen for http on")
+			maxBytes = fs.Int("maxbytes", 1<<20, "largest SenML message accepted in bytes, 0 for no limit")
+			maxRecords = fs.Int("maxrecords", 0, "most records accepted in a SenML message, 0 for no limit")
+		},
+		run: serve,
+	},
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: senmlCat <command> [options] [file...]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun senmlCat <command> -h for the options of a command. The options of a\n")
+	fmt.Fprintf(out, "command may come before or after its files. Files are read from stdin\n")
+	fmt.Fprintf(out, "when none is named. The exit status is 0 on success, 1 for SenML that\n")
+	fmt.Fprintf(out, "is not valid or files that differ, and 2 for other errors.\n")
+	fmt.Fprintf(out, "\nWithout a command senmlCat converts, taking these options:\n")
+	flag.PrintDefaults()
+}
+
+// formatValue is a flag holding a SenML format name
+type formatValue struct {
+	format *senml.Format
+}
+
+func (v formatValue) String() string {
+	if v.format == nil || *v.format == 0 {
+		return ""
+	}
+	return v.format.String()
+}
+
+func (v formatValue) Set(name string) error {
+	format, err := senml.ParseFormat(name)
+	if err != nil {
+		return err
+	}
+	*v.format = format
+	return nil
+}
+
+// main parses the options of the command, runs it and returns the exit code
+func (c *command) main(args []string) int {
+	fs := flag.NewFlagSet("senmlCat "+c.name, flag.ExitOnError)
+	if c.from {
+		fs.Var(formatValue{&inFormat}, "from", "input `format`, taken from the file name when not given")
+	}
+	if c.to {
+		fs.Var(formatValue{&outFormat}, "to", "output `format` (default json)")
+	}
+	for _, name := range c.flags {
+		f := flag.Lookup(name)
+		fs.Var(f.Value, name, f.Usage)
+	}
+	if c.extra != nil {
+		c.extra(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: senmlCat %s [options] %s\n\n%s\n\noptions:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	files := parseInterspersed(fs, args)
+
+	if c.args == "" && len(files) > 0 {
+		fmt.Fprintln(os.Stderr, "senmlCat:", c.name, "takes no files")
+		return exitError
+	}
+	names, err := setup(files)
+	if err != nil {
+		return finish(err)
+	}
+	return finish(c.run(names))
+}
+
+// parseInterspersed parses the options of a command wherever they are among
+// the files, so convert -r in out --to cbor takes the --to, and returns the
+// files. Everything after -- is a file.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var files []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return files
+		}
+		if consumed := args[:len(args)-len(rest)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(files, rest...)
+		}
+		files = append(files, rest[0])
+		args = rest[1:]
+	}
+}
+
+// fileReport is what validate found in one file
+type fileReport struct {
+	File     string          `json:"file"`
+	Valid    bool            `json:"valid"`
+	Problems []senml.Problem `json:"problems"`
+}
+
+// validateFile reads, decodes and checks one file. A file that can not be
+// read is reported as not valid.
+func validateFile(name string) fileReport {
+	ret := fileReport{File: name, Problems: []senml.Problem{}}
+
+	msg, err := readFile(name)
+	if err != nil {
+		if inner := errors.Unwrap(err); inner != nil {
+			err = inner
+		}
+		ret.Problems = append(ret.Problems, senml.Problem{Record: -1, Rule: "read", Message: err.Error()})
+		return ret
+	}
+
+	s, err := decodeFile(name, msg)
+	switch {
+	case errors.Is(err, senml.ErrNotValid):
+		ret.Problems = append(ret.Problems, senml.Validate(s)...)
+	case err != nil:
+		if inner := errors.Unwrap(err); inner != nil {
+			err = inner
+		}
+		ret.Problems = append(ret.Problems, senml.Problem{Record: -1, Rule: "decode", Message: err.Error()})
+		return ret
+	}
+	if *doWarnPtr {
+		ret.Problems = append(ret.Problems, senml.Lint(s)...)
+	}
+
+	ret.Valid = true
+	for _, p := range ret.Problems {
+		ret.Valid = ret.Valid && p.Warning
+	}
+	return ret
+}
+
+// validateFiles reports on each file, returning errInvalid if any is not
+// valid SenML
+func validateFiles(names []string) error {
+	var reports []fileReport
+	var failed bool
+
+	if *reportFormat != "text" && *reportFormat != "json" {
+		return fmt.Errorf("unknown report format %q", *reportFormat)
+	}
+	for _, name := range names {
+		report := validateFile(name)
+		reports = append(reports, report)
+		failed = failed || !report.Valid
+	}
+
+	switch {
+	case *reportFormat == "json":
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "%s\n", data)
+	default:
+		for _, report := range reports {
+			if len(report.Problems) == 0 {
+				fmt.Fprintf(output, "%s: ok\n", report.File)
+			}
+			for _, p := range report.Problems {
+				fmt.Fprintf(output, "%s: %v\n", report.File, p)
+			}
+		}
+	}
+
+	if failed {
+		return errInvalid
+	}
+	return nil
+}
+
+// sizeFormats are the formats stats gives the encoded size in
+var sizeFormats = []senml.Format{senml.JSON, senml.JSONLINE, senml.XML, senml.CBOR, senml.MPACK}
+
+// formatTime shows absolute times as dates
+func formatTime(t float64) string {
+	if t < 1<<28 {
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	sec, frac := math.Modf(t)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano)
+}
+
+// statsFiles summarizes the records of the files, and the size they take in
+// each format
+func statsFiles(names []string) error {
+	st := senml.NewStats()
+	sizes := map[senml.Format]int{}
+
+	add := func(s senml.SenML) error {
+		var err error
+		if pipeline != nil {
+			s, err = pipeline.Apply(s)
+			if err != nil {
+				return err
+			}
+		}
+		counted := st.Records
+		st.Add(s)
+		if st.Records == counted {
+			// size only the packs that left records, such as after a pipeline
+			return nil
+		}
+		for _, format := range sizeFormats {
+			data, err := senml.Encode(s, format, senml.OutputOptions{})
+			if err != nil {
+				return err
+			}
+			sizes[format] += len(data)
+		}
+		return nil
+	}
+
+	if *doStreamPtr {
+		for _, name := range names {
+			err := streamFile(name, add)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		packs, err := readPacks(names)
+		if err != nil {
+			return err
+		}
+		s := packs[0]
+		if len(packs) > 1 {
+			s = senml.Merge(packs...)
+		}
+		err = add(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	series := st.Series()
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "records\t%d\n", st.Records)
+	fmt.Fprintf(w, "names\t%d\n", len(series))
+	if st.Records > 0 {
+		fmt.Fprintf(w, "time\t%s to %s\n", formatTime(st.Start), formatTime(st.End))
+	}
+
+	fmt.Fprintf(w, "\nname\trecords\tkinds\tunits\tmin\tmax\tmean\n")
+	for _, ss := range series {
+		var kinds []string
+		for kind := range ss.Kinds {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s", ss.Name, ss.Records, strings.Join(kinds, ","), strings.Join(ss.Units, ","))
+		if ss.Values > 0 {
+			fmt.Fprintf(w, "\t%g\t%g\t%g\n", ss.Min, ss.Max, ss.Mean)
+		} else {
+			fmt.Fprintf(w, "\t\t\t\n")
+		}
+	}
+
+	fmt.Fprintf(w, "\nformat\tbytes\tvs json\n")
+	for _, format := range sizeFormats {
+		fmt.Fprintf(w, "%v\t%d", format, sizes[format])
+		if sizes[senml.JSON] > 0 {
+			fmt.Fprintf(w, "\t%.2f", float64(sizes[format])/float64(sizes[senml.JSON]))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	return w.Flush()
+}
+
+// serve converts each SenML message posted and writes or posts it on
+func serve(names []string) error {
+	var mu sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		// read one byte past the limit to tell if the body is too large
+		var body io.Reader = req.Body
+		if *maxBytes > 0 {
+			body = io.LimitReader(req.Body, int64(*maxBytes)+1)
+		}
+		msg, err := ioutil.ReadAll(body)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case *maxBytes > 0 && len(msg) > *maxBytes:
+			http.Error(w, "SenML message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s, err := decodeFile("request", msg)
+		switch {
+		case errors.Is(err, senml.ErrLimitExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err = processData(s)
+		if err == nil && output != nil {
+			err = output.Flush()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.ListenAndServe(":"+strconv.Itoa(*httpPort), mux)
+}
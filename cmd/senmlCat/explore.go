@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cisco/senml"
+)
+
+// sortKeys are the columns explore sorts on, in the order s steps through
+const (
+	sortTime = iota
+	sortName
+	sortValue
+	sortKeys
+)
+
+var sortNames = []string{"time", "name", "value"}
+
+// detailLines is the height of the panel for the selected record
+const detailLines = 6
+
+// explorer is the state of the explore screen
+type explorer struct {
+	title   string
+	format  senml.Format
+	records []senml.SenMLRecord
+	// shown are the indexes of the records passing the filter, in the order
+	// shown
+	shown    []int
+	filter   string
+	sortKey  int
+	reverse  bool
+	selected int
+	top      int
+
+	// editing is set while a filter is typed
+	editing bool
+	edit    string
+}
+
+func newExplorer(title string, format senml.Format, s senml.SenML) *explorer {
+	e := &explorer{title: title, format: format, records: senml.Normalize(s).Records}
+	e.update()
+	return e
+}
+
+// matches tells if a name passes the filter, a glob when it has any of *?[
+// and otherwise text the name must hold
+func (e *explorer) matches(name string) bool {
+	if strings.ContainsAny(e.filter, "*?[") {
+		match, _ := path.Match(e.filter, name)
+		return match
+	}
+	return strings.Contains(name, e.filter)
+}
+
+// update filters and sorts the records after a change of filter or order
+func (e *explorer) update() {
+	e.shown = e.shown[:0]
+	for i, r := range e.records {
+		if e.matches(r.Name) {
+			e.shown = append(e.shown, i)
+		}
+	}
+
+	value := func(r senml.SenMLRecord) float64 {
+		if r.Value == nil {
+			return math.Inf(-1)
+		}
+		return *r.Value
+	}
+	sort.SliceStable(e.shown, func(i, j int) bool {
+		a, b := e.records[e.shown[i]], e.records[e.shown[j]]
+		if e.reverse {
+			a, b = b, a
+		}
+		switch {
+		case e.sortKey == sortName && a.Name != b.Name:
+			return a.Name < b.Name
+		case e.sortKey == sortValue && value(a) != value(b):
+			return value(a) < value(b)
+		}
+		return a.Time < b.Time
+	})
+
+	if e.selected >= len(e.shown) {
+		e.selected = len(e.shown) - 1
+	}
+	if e.selected < 0 {
+		e.selected = 0
+	}
+}
+
+// key handles a key press, returning false to quit
+func (e *explorer) key(k string, rows int) bool {
+	if e.editing {
+		switch k {
+		case "\r", "\n":
+			e.filter = e.edit
+			e.editing = false
+			e.update()
+		case "\x1b":
+			e.editing = false
+		case "\x7f", "\b":
+			if len(e.edit) > 0 {
+				e.edit = e.edit[:len(e.edit)-1]
+			}
+		default:
+			if len(k) == 1 && k[0] >= ' ' {
+				e.edit += k
+			}
+		}
+		return true
+	}
+
+	switch k {
+	case "q", "\x03":
+		return false
+	case "j", "\x1b[B":
+		e.selected += 1
+	case "k", "\x1b[A":
+		e.selected -= 1
+	case " ", "\x1b[6~":
+		e.selected += rows
+	case "b", "\x1b[5~":
+		e.selected -= rows
+	case "g", "\x1b[H":
+		e.selected = 0
+	case "G", "\x1b[F":
+		e.selected = len(e.shown) - 1
+	case "s":
+		e.sortKey = (e.sortKey + 1) % sortKeys
+		e.update()
+	case "r":
+		e.reverse = !e.reverse
+		e.update()
+	case "/":
+		e.editing = true
+		e.edit = e.filter
+	}
+
+	if e.selected >= len(e.shown) {
+		e.selected = len(e.shown) - 1
+	}
+	if e.selected < 0 {
+		e.selected = 0
+	}
+	return true
+}
+
+// describeValue shows whichever value a record has
+func describeValue(r senml.SenMLRecord) string {
+	var parts []string
+	switch {
+	case r.Value != nil:
+		parts = append(parts, strconv.FormatFloat(*r.Value, 'g', -1, 64))
+	case r.StringValue != "":
+		parts = append(parts, strconv.Quote(r.StringValue))
+	case r.BoolValue != nil:
+		parts = append(parts, strconv.FormatBool(*r.BoolValue))
+	case r.DataValue != "":
+		parts = append(parts, "data "+r.DataValue)
+	}
+	if r.Sum != nil {
+		parts = append(parts, "sum "+strconv.FormatFloat(*r.Sum, 'g', -1, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+// finite returns the values that are not NaN or infinite
+func finite(values []float64) []float64 {
+	var ret []float64
+	for _, v := range values {
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// valueRange returns the smallest and largest of the values
+func valueRange(values []float64) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	return low, high
+}
+
+// sparkline draws values as a row of bars scaled between the smallest and
+// largest, taking the last width values. Values that are not finite are
+// left out.
+func sparkline(values []float64, width int) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	values = finite(values)
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	low, high := valueRange(values)
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if high > low {
+			// halved so the range of the largest floats does not overflow
+			i = int((v/2 - low/2) / (high/2 - low/2) * float64(len(bars)-1))
+		}
+		b.WriteRune(bars[i])
+	}
+	return b.String()
+}
+
+// fit cuts or pads text to width columns
+func fit(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// render draws the screen
+func (e *explorer) render(w io.Writer, width int, height int) {
+	rows := height - detailLines - 3
+	if rows < 1 {
+		rows = 1
+	}
+	if e.selected < e.top {
+		e.top = e.selected
+	}
+	if e.selected >= e.top+rows {
+		e.top = e.selected - rows + 1
+	}
+
+	nameWidth := 4
+	for _, i := range e.shown {
+		if n := len(e.records[i].Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	if nameWidth > width/2 {
+		nameWidth = width / 2
+	}
+	order := sortNames[e.sortKey]
+	if e.reverse {
+		order += " reversed"
+	}
+
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+	fmt.Fprintf(w, "\x1b[1m%s\x1b[0m\r\n", fit(fmt.Sprintf("%s  %d of %d records  filter %q  sorted by %s", e.title, len(e.shown), len(e.records), e.filter, order), width))
+	fmt.Fprintf(w, "\x1b[4m%s\x1b[0m\r\n", fit(fmt.Sprintf("%-*s  %-24s  %-6s  %s", nameWidth, "name", "time", "unit", "value"), width))
+	for row := 0; row < rows; row++ {
+		n := e.top + row
+		if n >= len(e.shown) {
+			fmt.Fprint(w, "\r\n")
+			continue
+		}
+		r := e.records[e.shown[n]]
+		line := fit(fmt.Sprintf("%-*s  %-24s  %-6s  %s", nameWidth, fit(r.Name, nameWidth), formatTime(r.Time), r.Unit, describeValue(r)), width)
+		if n == e.selected {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		fmt.Fprint(w, line+"\r\n")
+	}
+
+	for _, line := range e.detail(width) {
+		fmt.Fprint(w, fit(line, width)+"\r\n")
+	}
+
+	if e.editing {
+		fmt.Fprint(w, "filter: "+e.edit)
+	} else {
+		fmt.Fprint(w, fit("j/k move  space/b page  s sort  r reverse  / filter  q quit", width))
+	}
+}
+
+// detail describes the selected record: its series as a sparkline and the
+// resolved record encoded again on its own in the input format, which is not
+// the bytes it was read from
+func (e *explorer) detail(width int) []string {
+	lines := make([]string, detailLines)
+	if len(e.shown) == 0 {
+		lines[0] = "no records"
+		return lines
+	}
+	r := e.records[e.shown[e.selected]]
+
+	// the series in time order, whatever order the table is in
+	var series []senml.SenMLRecord
+	for _, other := range e.records {
+		if other.Name == r.Name && other.Value != nil {
+			series = append(series, other)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Time < series[j].Time
+	})
+	lines[0] = fmt.Sprintf("%s  %d numeric values", r.Name, len(series))
+	values := make([]float64, len(series))
+	for i, s := range series {
+		values[i] = *s.Value
+	}
+	// over the values the sparkline draws
+	if values = finite(values); len(values) > 0 {
+		low, high := valueRange(values)
+		lines[0] += fmt.Sprintf("  min %g  max %g", low, high)
+		lines[1] = sparkline(values, width)
+	}
+
+	data, err := senml.Encode(senml.SenML{Records: []senml.SenMLRecord{r}}, e.format, senml.OutputOptions{})
+	if err != nil {
+		lines[2] = err.Error()
+		return lines
+	}
+	text := string(data)
+	if e.format == senml.CBOR || e.format == senml.MPACK {
+		text = hex.EncodeToString(data)
+	}
+	lines[2] = fmt.Sprintf("resolved and re-encoded as %v, %d bytes:", e.format, len(data))
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", " ")
+	for i := 3; i < detailLines && len(text) > 0; i++ {
+		n := width
+		if n > len(text) {
+			n = len(text)
+		}
+		lines[i], text = text[:n], text[n:]
+	}
+	return lines
+}
+
+// stty runs stty on the terminal and returns what it prints
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the width and height of the terminal
+func terminalSize() (int, int) {
+	size, err := stty("size")
+	var rows, cols int
+	if err == nil {
+		_, err = fmt.Sscan(size, &rows, &cols)
+	}
+	if err != nil || rows == 0 || cols == 0 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+// readKey reads a key press, keeping the escape sequences of the arrow and
+// paging keys together
+func readKey(in *bufio.Reader) (string, error) {
+	c, err := in.ReadByte()
+	if err != nil || c != 0x1b {
+		return string(c), err
+	}
+	if in.Buffered() == 0 {
+		return "\x1b", nil
+	}
+	key := []byte{c}
+	for in.Buffered() > 0 {
+		c, _ = in.ReadByte()
+		key = append(key, c)
+		if len(key) > 2 && (c >= 'A' && c <= 'Z' || c == '~') {
+			break
+		}
+	}
+	return string(key), nil
+}
+
+// exploreFiles shows the records of the files in a terminal screen
+func exploreFiles(names []string) error {
+	if names[0] == "-" {
+		return errors.New("explore reads keys from stdin, so it needs a file")
+	}
+
+	packs, err := readPacks(names)
+	if err != nil {
+		return err
+	}
+	s := senml.Merge(packs...)
+	if pipeline != nil {
+		s, err = pipeline.Apply(s)
+		if err != nil {
+			return err
+		}
+	}
+	e := newExplorer(strings.Join(names, " "), inputFormat(names[0]), s)
+
+	saved, err := stty("-g")
+	if err != nil {
+		return errors.New("explore needs a terminal")
+	}
+	_, err = stty("raw", "-echo")
+	if err != nil {
+		return err
+	}
+	defer stty(saved)
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		width, height := terminalSize()
+		e.render(w, width, height)
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		k, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		if !e.key(k, height-detailLines-3) {
+			return nil
+		}
+	}
+}
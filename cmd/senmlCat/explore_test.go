@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func explorePack() senml.SenML {
+	v1 := 3.0
+	v2 := 1.0
+	v3 := 2.0
+	return senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev/", BaseTime: 1600000000, Name: "temp", Value: &v1},
+		{Name: "hum", Value: &v2, Time: 10},
+		{Name: "temp", Value: &v3, Time: 20},
+	}}
+}
+
+func shownNames(e *explorer) string {
+	var names []string
+	for _, i := range e.shown {
+		names = append(names, e.records[i].Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestExplorerUpdate(t *testing.T) {
+	e := newExplorer("test", senml.JSON, explorePack())
+	if got := shownNames(e); got != "dev/temp,dev/hum,dev/temp" {
+		t.Error("time order got", got)
+	}
+
+	e.sortKey = sortValue
+	e.update()
+	if got := shownNames(e); got != "dev/hum,dev/temp,dev/temp" {
+		t.Error("value order got", got)
+	}
+
+	e.reverse = true
+	e.filter = "*/temp"
+	e.selected = 2
+	e.update()
+	if got := shownNames(e); got != "dev/temp,dev/temp" || *e.records[e.shown[0]].Value != 3 {
+		t.Error("filtered reverse order got", got)
+	}
+	if e.selected != 1 {
+		t.Error("selection after filter got", e.selected)
+	}
+}
+
+func TestExplorerKey(t *testing.T) {
+	e := newExplorer("test", senml.JSON, explorePack())
+	for _, k := range []string{"j", "j", "j", "\x1b[B"} {
+		e.key(k, 10)
+	}
+	if e.selected != 2 {
+		t.Error("moving past the end got", e.selected)
+	}
+	e.key("b", 10)
+	if e.selected != 0 {
+		t.Error("paging before the start got", e.selected)
+	}
+
+	e.key("s", 10)
+	if e.sortKey != sortName || shownNames(e) != "dev/hum,dev/temp,dev/temp" {
+		t.Error("sorting on name got", e.sortKey, shownNames(e))
+	}
+
+	for _, k := range []string{"/", "h", "u", "x", "\x7f", "\r"} {
+		e.key(k, 10)
+	}
+	if e.editing || e.filter != "hu" || shownNames(e) != "dev/hum" {
+		t.Error("filter got", e.filter, shownNames(e))
+	}
+
+	if e.key("q", 10) {
+		t.Error("q did not quit")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 7, 14}, 10); got != "▁▄█" {
+		t.Error("sparkline got", got)
+	}
+	if got := sparkline([]float64{0, 1, 2, 3}, 2); got != "▁█" {
+		t.Error("sparkline of the last values got", got)
+	}
+	if got := sparkline([]float64{5, 5}, 10); got != "▁▁" {
+		t.Error("sparkline of a flat series got", got)
+	}
+	if got := sparkline([]float64{0, math.Inf(1), math.NaN(), 7, math.Inf(-1)}, 10); got != "▁█" {
+		t.Error("sparkline with values not finite got", got)
+	}
+	if got := sparkline([]float64{-math.MaxFloat64, math.MaxFloat64}, 10); got != "▁█" {
+		t.Error("sparkline of the largest floats got", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := fit("abc", 5); got != "abc  " {
+		t.Errorf("fit padding got %q", got)
+	}
+	if got := fit("▁▂▃▄", 2); got != "▁▂" {
+		t.Errorf("fit cutting got %q", got)
+	}
+}
+
+func TestExplorerDetail(t *testing.T) {
+	e := newExplorer("test", senml.JSON, explorePack())
+	lines := e.detail(80)
+	if len(lines) != detailLines {
+		t.Fatal("detail lines got", len(lines))
+	}
+	if lines[0] != "dev/temp  2 numeric values  min 2  max 3" || lines[1] != "█▁" {
+		t.Error("detail series got", lines[:2])
+	}
+	if !strings.HasPrefix(lines[2], "resolved and re-encoded as json") || lines[3] != `[{"bver":5,"n":"dev/temp","t":1600000000,"v":3}]` {
+		t.Error("detail record got", lines[2:4])
+	}
+
+	nan := math.NaN()
+	s := explorePack()
+	s.Records = append(s.Records, senml.SenMLRecord{Name: "temp", Value: &nan, Time: 30})
+	e = newExplorer("test", senml.JSON, s)
+	if lines = e.detail(80); lines[0] != "dev/temp  3 numeric values  min 2  max 3" || lines[1] != "█▁" {
+		t.Error("detail series with NaN got", lines[:2])
+	}
+
+	e.filter = "none"
+	e.update()
+	if lines = e.detail(80); lines[0] != "no records" {
+		t.Error("detail of no records got", lines[0])
+	}
+}
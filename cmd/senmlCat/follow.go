@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cisco/senml"
+)
+
+// followState is what the offset file keeps so following resumes where it
+// stopped: the offset of the first line not yet processed and the base fields
+// in effect there
+type followState struct {
+	Offset      int64   `json:"offset"`
+	BaseName    string  `json:"bn,omitempty"`
+	BaseTime    float64 `json:"bt,omitempty"`
+	BaseUnit    string  `json:"bu,omitempty"`
+	BaseVersion int     `json:"bver,omitempty"`
+}
+
+func readState(name string) (followState, error) {
+	var state followState
+
+	data, err := ioutil.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("offset file %s: %w", name, err)
+	}
+	return state, nil
+}
+
+// writeState replaces the offset file in one step so a crash leaves the old
+// or the new offset
+func writeState(name string, state followState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// followFile processes the JSON lines of a file as they are appended to it,
+// like tail -f. The offset reached is saved after each batch is written out,
+// so records are not lost when senmlCat is restarted, though the last batch
+// may be sent again. A file truncated or replaced by log rotation is read
+// again from the start.
+func followFile(name string) error {
+	if name == "-" || inputFormat(name) != senml.JSONLINE {
+		return errors.New("-follow needs a JSON lines file, see -ijsonl")
+	}
+
+	var state followState
+	var err error
+	if *offsetFile != "" {
+		state, err = readState(*offsetFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < state.Offset {
+		state = followState{}
+	}
+	_, err = f.Seek(state.Offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	bases := senml.SenMLRecord{
+		BaseName:    state.BaseName,
+		BaseTime:    state.BaseTime,
+		BaseUnit:    state.BaseUnit,
+		BaseVersion: state.BaseVersion,
+	}
+	reader := bufio.NewReader(f)
+	var batch []byte
+	var partial []byte
+	lines := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		if err == nil {
+			batch = append(batch, partial...)
+			batch = append(batch, line...)
+			partial = nil
+			lines += 1
+		} else {
+			// keep a line still being written until its end arrives
+			partial = append(partial, line...)
+		}
+
+		if lines > 0 && (err == io.EOF || lines == streamBatch) {
+			s, decodeErr := decodeBatch(batch, &bases)
+			if decodeErr != nil {
+				return fmt.Errorf("decoding %s: %w", name, decodeErr)
+			}
+			if len(s.Records) > 0 {
+				decodeErr = processBatch(s)
+				if decodeErr != nil {
+					return decodeErr
+				}
+			}
+
+			state.Offset += int64(len(batch))
+			state.BaseName = bases.BaseName
+			state.BaseTime = bases.BaseTime
+			state.BaseUnit = bases.BaseUnit
+			state.BaseVersion = bases.BaseVersion
+			if *offsetFile != "" {
+				decodeErr = writeState(*offsetFile, state)
+				if decodeErr != nil {
+					return decodeErr
+				}
+			}
+			batch = batch[:0]
+			lines = 0
+		}
+
+		if err != io.EOF {
+			continue
+		}
+
+		time.Sleep(*followPoll)
+
+		// start again on a new file when the one open was rotated away or
+		// truncated
+		current, statErr := os.Stat(name)
+		opened, openedErr := f.Stat()
+		if statErr != nil || openedErr != nil {
+			continue
+		}
+		end := state.Offset + int64(len(partial))
+		if os.SameFile(current, opened) && current.Size() >= end {
+			continue
+		}
+		if os.SameFile(current, opened) || end >= opened.Size() {
+			newFile, openErr := os.Open(name)
+			if openErr != nil {
+				continue
+			}
+			f.Close()
+			f = newFile
+			reader.Reset(f)
+			partial = nil
+			state = followState{}
+			bases = senml.SenMLRecord{}
+		}
+	}
+}
@@ -7,14 +7,21 @@ import (
 	"flag"
 	"fmt"
 	"github.com/cisco/senml"
+	"github.com/cisco/senml/cose"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"runtime/pprof"
+	"strings"
+	"time"
 )
 
-var doIndentPtr = flag.Bool("i", false, "indent output")
-var doPrintPtr = flag.Bool("print", false, "print output to stdout")
+var doIndentPtr = flag.Bool("i", false, "indent output, or show CBOR and MessagePack as diagnostic notation")
+var doPrintPtr = flag.Bool("print", false, "print output to stdout even when posting it")
+var outputFile = flag.String("o", "", "write output to this file instead of stdout")
 var doResolvePtr = flag.Bool("resolve", false, "resolve SenML records")
 var postUrl = flag.String("post", "", "URL to HTTP POST output to")
 var topic = flag.String("topic", "senml", "Apache Kafka topic or InfluxDB series name ")
@@ -26,58 +33,132 @@ var doCsvPtr = flag.Bool("csv", false, "output CSV formatted SenML ")
 var doMpackPtr = flag.Bool("mpack", false, "output MessagePack formatted SenML ")
 var doLinpPtr = flag.Bool("linp", false, "output InfluxDB LineProtcol formatted SenML ")
 var doJsonLinePtr = flag.Bool("jsonl", false, "outpute JSON formatted SenML Record lines")
+var doTablePtr = flag.Bool("table", false, "output SenML as a table for people to read")
+var doCborDiagPtr = flag.Bool("cbordiag", false, "output CBOR formatted SenML as diagnostic notation")
+var doCborHexPtr = flag.Bool("cborhex", false, "output CBOR formatted SenML as hex, annotated with -i")
 
 var doIJsonStreamPtr = flag.Bool("ijson", false, "input JSON formatted SenML")
 var doIJsonLinePtr = flag.Bool("ijsonl", false, "input JSON formatted SenML Record lines")
 var doIXmlPtr = flag.Bool("ixml", false, "input XML formatted SenML ")
 var doICborPtr = flag.Bool("icbor", false, "input CBOR formatted SenML ")
 var doIMpackPtr = flag.Bool("impack", false, "input MessagePack formatted SenML ")
+var doICborDiagPtr = flag.Bool("icbordiag", false, "input CBOR formatted SenML written as diagnostic notation")
+var doICborHexPtr = flag.Bool("icborhex", false, "input CBOR formatted SenML written as hex")
+var doLenientPtr = flag.Bool("lenient", false, "accept draft-era SenML field names and encodings")
+var doSkipBadPtr = flag.Bool("skipbad", false, "skip JSON lines that can not be decoded")
+var doStrictPtr = flag.Bool("strict", false, "reject SenML with unknown or duplicate fields, wrong types or trailing data")
 
-func decodeTimed(msg []byte) (senml.SenML, error) {
-	var s senml.SenML
-	var err error
+var signKeyFile = flag.String("sign", "", "output CBOR SenML signed with COSE_Sign1 using the EC or Ed25519 private key in this PEM file")
+var macKeyFile = flag.String("mac", "", "output CBOR SenML in COSE_Mac0 using the hex symmetric key in this file")
+var verifyKeyFile = flag.String("verify", "", "input CBOR SenML in COSE_Sign1 or COSE_Mac0, checked with the key in this file")
+var keyID = flag.String("kid", "", "key identifier to put in signed output")
 
-	var format senml.Format = senml.JSON
+var pipelineSpec = flag.String("pipeline", "", "filter and transform records, such as \"name room1/*; scale */temp 1.8 32\"")
+var pipelineFile = flag.String("pipelinefile", "", "file holding a pipeline to filter and transform records")
+var doCompactPtr = flag.Bool("compact", false, "move common names, times and units into base fields")
+var whereExpr = flag.String("where", "", "keep records matching an expression, such as 'n =~ \"temp.*\" && v > 30'")
+var doDiffPtr = flag.Bool("diff", false, "compare the records of two SenML files, exiting with 1 if they differ")
+var doStreamPtr = flag.Bool("stream", false, "process JSON lines input a batch of lines at a time, writing out each batch as it goes")
+var doFollowPtr = flag.Bool("follow", false, "process JSON lines as they are appended to the file, like tail -f")
+var offsetFile = flag.String("offsetfile", "", "with -follow, file keeping the offset reached so a restart resumes from it")
+var followPoll = flag.Duration("poll", time.Second, "with -follow, how often to check the file for new lines")
+var doRecursePtr = flag.Bool("r", false, "convert every SenML file under the first directory named into the second, keeping relative paths")
+var batchWorkers = flag.Int("j", runtime.NumCPU(), "with -r, how many files to convert at once")
+
+var pipeline senml.Pipeline = nil
+var verifyKey interface{} = nil
+
+// inFormat and outFormat are the formats chosen, or 0 for the defaults
+var inFormat senml.Format = 0
+var outFormat senml.Format = 0
+
+const (
+	exitOK = 0
+	// exitFailed is for SenML that did not validate or files that differ
+	exitFailed = 1
+	// exitError is for bad usage and input that could not be read or decoded
+	exitError = 2
+)
+
+var errDiffer = errors.New("SenML files differ")
+var errInvalid = errors.New("SenML is not valid")
+
+// output is where the SenML is written, or nil when it is only posted
+var output *bufio.Writer = nil
+
+// streamBatch is the number of JSON lines processed at a time with -stream
+const streamBatch = 1000
+
+// inputFormat returns the format chosen for the input, or else the one the
+// file name suggests
+func inputFormat(name string) senml.Format {
+	fileFormat, ok := senml.FormatForFile(name)
 	switch {
-	case *doIJsonStreamPtr:
-		format = senml.JSON
-	case *doIJsonLinePtr:
-		format = senml.JSONLINE
-	case *doICborPtr:
-		format = senml.CBOR
-	case *doIXmlPtr:
-		format = senml.XML
-	case *doIMpackPtr:
-		format = senml.MPACK
+	case *verifyKeyFile != "":
+		return senml.CBOR
+	case inFormat != 0:
+		return inFormat
+	case ok:
+		return fileFormat
 	}
+	return senml.JSON
+}
 
-	s, err = senml.Decode(msg, format)
+func decodeTimed(msg []byte, format senml.Format) (senml.SenML, error) {
+	var s senml.SenML
+	var err error
+
+	var report senml.DecodeReport
+	options := senml.DecodeOptions{
+		Lenient:      *doLenientPtr,
+		Strict:       *doStrictPtr,
+		MaxBytes:     *maxBytes,
+		MaxRecords:   *maxRecords,
+		SkipBadLines: *doSkipBadPtr,
+	}
+	s, report, err = senml.DecodeWithOptions(msg, format, options)
+	if len(report.Legacy) > 0 {
+		fmt.Fprintln(os.Stderr, "Legacy SenML seen:", strings.Join(report.Legacy, ", "))
+	}
+	for _, lineErr := range report.Skipped {
+		fmt.Fprintln(os.Stderr, "Skipped", lineErr)
+	}
 
 	return s, err
 }
 
+// toSymmetricKey returns the key bytes, or nil so the MAC fails for a key that
+// is not symmetric
+func toSymmetricKey(key interface{}) []byte {
+	b, _ := key.([]byte)
+	return b
+}
+
 func outputData(data []byte) error {
-	if *doPrintPtr {
-		fmt.Print(string(data))
+	if output != nil {
+		_, err := output.Write(data)
+		if err != nil {
+			return err
+		}
 	}
 
 	if len(*postUrl) != 0 {
-		fmt.Println("PostURL=<" + string(*postUrl) + ">")
+		fmt.Fprintln(os.Stderr, "PostURL=<"+string(*postUrl)+">")
 		buffer := bytes.NewBuffer(data)
 		resp, err := http.Post(string(*postUrl), "application/senml+json", buffer)
 		if err != nil {
-			fmt.Println("Post to", string(*postUrl), " got error", err.Error())
+			fmt.Fprintln(os.Stderr, "Post to", string(*postUrl), " got error", err.Error())
 			return err
 		}
 		defer resp.Body.Close()
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			fmt.Println("error reading response body: %v", err)
+			fmt.Fprintln(os.Stderr, "error reading response body:", err)
 			return err
 		}
 		if resp.StatusCode != 204 {
-			fmt.Println("Post got status ", resp.Status)
-			fmt.Println("Post got", string(body))
+			fmt.Fprintln(os.Stderr, "Post got status ", resp.Status)
+			fmt.Fprintln(os.Stderr, "Post got", string(body))
 			return errors.New("WebServer returned: " + string(body))
 		}
 	}
@@ -85,21 +166,25 @@ func outputData(data []byte) error {
 	return nil
 }
 
-func processData(dataIn []byte) error {
-	var s senml.SenML
+// encodeData transforms the records as the flags ask and encodes them
+func encodeData(s senml.SenML) ([]byte, error) {
 	var err error
 
-	s, err = decodeTimed(dataIn)
-	if err != nil {
-		fmt.Println("Decode of SenML failed")
-		return err
-	}
-
 	//fmt.Println( "Senml:", senml.Records )
 	if *doResolvePtr {
 		s = senml.Normalize(s)
 	}
 
+	if pipeline != nil {
+		s, err = pipeline.Apply(s)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline failed: %w", err)
+		}
+	}
+	if *doCompactPtr {
+		s = senml.Compact(s)
+	}
+
 	var dataOut []byte
 	options := senml.OutputOptions{}
 	if *doIndentPtr {
@@ -107,25 +192,35 @@ func processData(dataIn []byte) error {
 	}
 	options.Topic = string(*topic)
 	var format senml.Format = senml.JSON
+	if outFormat != 0 {
+		format = outFormat
+	}
 	switch {
-	case *doJsonPtr:
-		format = senml.JSON
-	case *doJsonLinePtr:
-		format = senml.JSONLINE
-	case *doCborPtr:
-		format = senml.CBOR
-	case *doXmlPtr:
-		format = senml.XML
-	case *doCsvPtr:
-		format = senml.CSV
-	case *doMpackPtr:
-		format = senml.MPACK
-	case *doLinpPtr:
-		format = senml.LINEP
-	}
-	dataOut, err = senml.Encode(s, format, options)
+	case *signKeyFile != "":
+		var key interface{}
+		key, err = cose.ReadKeyFile(*signKeyFile)
+		if err == nil {
+			dataOut, err = cose.Sign(s, key, []byte(*keyID))
+		}
+	case *macKeyFile != "":
+		var key interface{}
+		key, err = cose.ReadKeyFile(*macKeyFile)
+		if err == nil {
+			dataOut, err = cose.MAC(s, toSymmetricKey(key), []byte(*keyID))
+		}
+	default:
+		dataOut, err = senml.Encode(s, format, options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode of SenML failed: %w", err)
+	}
+
+	return dataOut, nil
+}
+
+func processData(s senml.SenML) error {
+	dataOut, err := encodeData(s)
 	if err != nil {
-		fmt.Println("Encode of SenML failed")
 		return err
 	}
 
@@ -135,19 +230,19 @@ func processData(dataIn []byte) error {
 		for lines.Scan() {
 			err = outputData([]byte(lines.Text()))
 			if err != nil {
-				fmt.Println("Output of SenML failed:", err)
+				fmt.Fprintln(os.Stderr, "Output of SenML failed:", err)
 				return err
 			}
 		}
 
 		err = lines.Err()
 		if err != nil {
-			fmt.Println("Encode scanning lines in output")
+			fmt.Fprintln(os.Stderr, "Encode scanning lines in output")
 		}
 	} else {
 		err = outputData(dataOut)
 		if err != nil {
-			fmt.Println("Output of SenML failed:", err)
+			fmt.Fprintln(os.Stderr, "Output of SenML failed:", err)
 			return err
 		}
 	}
@@ -155,33 +250,470 @@ func processData(dataIn []byte) error {
 	return nil
 }
 
-func main() {
+// loadPipeline builds the pipeline named by the flags, or nil for none
+func loadPipeline() (senml.Pipeline, error) {
+	var p senml.Pipeline
+
+	if len(*pipelineFile) != 0 {
+		filePipeline, err := senml.ReadPipelineFile(*pipelineFile)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, filePipeline...)
+	}
+	if len(*pipelineSpec) != 0 {
+		flagPipeline, err := senml.ParsePipeline(*pipelineSpec)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, flagPipeline...)
+	}
+	if len(*whereExpr) != 0 {
+		filter, err := senml.CompileFilter(*whereExpr)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, filter)
+	}
+
+	return p, nil
+}
+
+// legacyFormats sets inFormat and outFormat from the format flags, as long as
+// at most one is given for each
+func legacyFormats() error {
+	type choice struct {
+		name   string
+		set    *bool
+		format senml.Format
+	}
+	pick := func(what string, choices []choice) (senml.Format, error) {
+		var format senml.Format = 0
+		var chosen string
+		for _, c := range choices {
+			if !*c.set {
+				continue
+			}
+			if format != 0 {
+				return 0, fmt.Errorf("-%s and -%s both choose the %s format", chosen, c.name, what)
+			}
+			format = c.format
+			chosen = c.name
+		}
+		return format, nil
+	}
+
+	var err error
+	inFormat, err = pick("input", []choice{
+		{"ijson", doIJsonStreamPtr, senml.JSON},
+		{"ijsonl", doIJsonLinePtr, senml.JSONLINE},
+		{"icbor", doICborPtr, senml.CBOR},
+		{"ixml", doIXmlPtr, senml.XML},
+		{"impack", doIMpackPtr, senml.MPACK},
+		{"icbordiag", doICborDiagPtr, senml.CBORDIAG},
+		{"icborhex", doICborHexPtr, senml.CBORHEX},
+	})
+	if err != nil {
+		return err
+	}
+	outFormat, err = pick("output", []choice{
+		{"json", doJsonPtr, senml.JSON},
+		{"jsonl", doJsonLinePtr, senml.JSONLINE},
+		{"cbor", doCborPtr, senml.CBOR},
+		{"xml", doXmlPtr, senml.XML},
+		{"csv", doCsvPtr, senml.CSV},
+		{"mpack", doMpackPtr, senml.MPACK},
+		{"linp", doLinpPtr, senml.LINEP},
+		{"table", doTablePtr, senml.TABLE},
+		{"cbordiag", doCborDiagPtr, senml.CBORDIAG},
+		{"cborhex", doCborHexPtr, senml.CBORHEX},
+	})
+	return err
+}
+
+// checkOptions reports choices that can not be used together
+func checkOptions() error {
+	switch {
+	case *signKeyFile != "" && *macKeyFile != "":
+		return errors.New("-sign and -mac can not be used together")
+	case (*signKeyFile != "" || *macKeyFile != "") && outFormat != 0 && outFormat != senml.CBOR:
+		return fmt.Errorf("signed output is CBOR, not %v", outFormat)
+	case *verifyKeyFile != "" && inFormat != 0 && inFormat != senml.CBOR:
+		return fmt.Errorf("signed input is CBOR, not %v", inFormat)
+	case *doStreamPtr && *doDiffPtr:
+		return errors.New("-stream can not be used with -diff")
+	case *doStreamPtr && *verifyKeyFile != "":
+		return errors.New("-stream can not be used with -verify")
+	case *doFollowPtr && (*doStreamPtr || *doDiffPtr || *verifyKeyFile != ""):
+		return errors.New("-follow can not be used with -stream, -diff or -verify")
+	case (*doStreamPtr || *doFollowPtr) && (*signKeyFile != "" || *macKeyFile != ""):
+		return errors.New("-stream and -follow can not be used with -sign or -mac")
+	case (*doStreamPtr || *doFollowPtr) && outFormat != 0 && outFormat != senml.JSONLINE && outFormat != senml.CSV && outFormat != senml.LINEP:
+		return fmt.Errorf("-stream and -follow write a batch at a time, so they need jsonl, csv or linp output, not %v", outFormat)
+	case *doRecursePtr && (*outputFile != "" || *postUrl != "" || *doStreamPtr || *doFollowPtr || *doDiffPtr):
+		return errors.New("-r writes files and can not be used with -o, -post, -stream, -follow or -diff")
+	}
+	return nil
+}
+
+// setup loads what the flags name and opens the output. It returns the input
+// files.
+func setup(args []string) ([]string, error) {
 	var err error
 
+	err = checkOptions()
+	if err != nil {
+		return nil, err
+	}
+	if (*doStreamPtr || *doFollowPtr) && outFormat == 0 {
+		// batches of JSON lines join up, where JSON arrays would not
+		outFormat = senml.JSONLINE
+	}
+
+	pipeline, err = loadPipeline()
+	if err != nil {
+		return nil, fmt.Errorf("error in pipeline: %w", err)
+	}
+
+	if *verifyKeyFile != "" {
+		verifyKey, err = cose.ReadKeyFile(*verifyKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key file: %w", err)
+		}
+	}
+
+	names, err := expandArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(*outputFile) != 0:
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			return nil, fmt.Errorf("error creating output file: %w", err)
+		}
+		output = bufio.NewWriter(f)
+	case len(*postUrl) == 0 || *doPrintPtr:
+		output = bufio.NewWriter(os.Stdout)
+	}
+
+	return names, nil
+}
+
+// finish flushes the output and returns the exit code for the result of a
+// command
+func finish(err error) int {
+	if output != nil {
+		flushErr := output.Flush()
+		if err == nil {
+			err = flushErr
+		}
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errDiffer) || errors.Is(err, errInvalid):
+		return exitFailed
+	}
+	fmt.Fprintln(os.Stderr, "senmlCat:", err)
+	return exitError
+}
+
+func main() {
 	if false {
 		f, err := os.Create("senmlCat.prof")
 		if err != nil {
-			fmt.Println("error opening profile file", err)
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, "error opening profile file", err)
+			os.Exit(exitError)
 		}
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
 
+	args := os.Args[1:]
+	flag.Usage = usage
+	if len(args) > 0 {
+		if args[0] == "help" {
+			usage()
+			os.Exit(exitOK)
+		}
+		if c := findCommand(args[0]); c != nil {
+			os.Exit(c.main(args[1:]))
+		}
+	}
+
+	// without a command senmlCat takes the flags it always has
 	flag.Parse()
+	err := legacyFormats()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "senmlCat:", err)
+		os.Exit(exitError)
+	}
+	names, err := setup(flag.Args())
+	if err == nil {
+		if *doDiffPtr {
+			err = diffFiles(names)
+		} else {
+			err = convertFiles(names)
+		}
+	}
+	os.Exit(finish(err))
+}
+
+// expandArgs expands the glob patterns among the file names, and returns "-"
+// for stdin when no file is named
+func expandArgs(args []string) ([]string, error) {
+	var names []string
+
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			names = append(names, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad file pattern %q: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no SenML file matches %q", arg)
+		}
+		names = append(names, matches...)
+	}
+
+	return names, nil
+}
+
+// openInput opens a file, or stdin for "-"
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// readFile reads a file, or stdin for "-"
+func readFile(name string) ([]byte, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	msg, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return msg, nil
+}
+
+// decodeFile checks the signature of a file read, when there is a key, and
+// decodes it
+func decodeFile(name string, msg []byte) (senml.SenML, error) {
+	return decodeFileAs(name, msg, inputFormat(name))
+}
+
+func decodeFileAs(name string, msg []byte, format senml.Format) (senml.SenML, error) {
+	var err error
+
+	if verifyKey != nil {
+		msg, err = cose.Verify(msg, verifyKey)
+		if err != nil {
+			return senml.SenML{}, fmt.Errorf("verifying %s: %w", name, err)
+		}
+	}
+
+	s, err := decodeTimed(msg, format)
+	if err != nil {
+		return s, fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// readPacks reads and decodes each file
+func readPacks(names []string) ([]senml.SenML, error) {
+	var packs []senml.SenML
+
+	for _, name := range names {
+		msg, err := readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		s, err := decodeFile(name, msg)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, s)
+	}
+
+	return packs, nil
+}
+
+// convertFiles processes the files, merging the packs when there are several
+func convertFiles(names []string) error {
+	if *doRecursePtr {
+		if len(names) != 2 {
+			return errors.New("-r takes an input and an output directory")
+		}
+		return convertTree(names[0], names[1])
+	}
+	if *doFollowPtr {
+		if len(names) != 1 {
+			return errors.New("-follow takes one file")
+		}
+		return followFile(names[0])
+	}
+	if *doStreamPtr {
+		for _, name := range names {
+			err := streamFile(name, processBatch)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	packs, err := readPacks(names)
+	if err != nil {
+		return err
+	}
+
+	s := packs[0]
+	if len(packs) > 1 {
+		s = senml.Merge(packs...)
+	}
+
+	return processData(s)
+}
 
-	//fmt.Print("Reading file ...")
-	// load the input
-	msg, err := ioutil.ReadFile(flag.Arg(0))
+// diffFiles writes the differences between two files
+func diffFiles(names []string) error {
+	if len(names) != 2 {
+		return errors.New("diff needs two SenML files")
+	}
+	packs, err := readPacks(names)
 	if err != nil {
-		fmt.Println("error reading SenML file", err)
-		os.Exit(1)
+		return err
 	}
-	//fmt.Println("Done")
 
-	err = processData(msg)
+	report := senml.Diff(packs[0], packs[1])
+	err = outputData([]byte(report.String()))
+	if err == nil && !report.Empty() {
+		err = errDiffer
+	}
+	return err
+}
+
+// processBatch processes a batch of a stream and writes it out at once
+func processBatch(s senml.SenML) error {
+	err := processData(s)
+	if err == nil && output != nil {
+		err = output.Flush()
+	}
+	return err
+}
+
+// streamFile passes JSON lines to process a batch at a time so large inputs
+// need not fit in memory. The base fields in effect at the end of a batch are put on
+// the first record of the next, so each batch resolves on its own.
+func streamFile(name string, process func(s senml.SenML) error) error {
+	if inputFormat(name) != senml.JSONLINE {
+		return fmt.Errorf("-stream needs JSON lines input, see -ijsonl")
+	}
+
+	in, err := openInput(name)
 	if err != nil {
-		fmt.Println("error processing SenML file", err)
-		os.Exit(1)
+		return err
+	}
+	defer in.Close()
+
+	var bases senml.SenMLRecord
+	var batch []byte
+	lines := 0
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		if len(line) > 0 {
+			batch = append(batch, line...)
+			lines += 1
+		}
+
+		if lines == streamBatch || (err == io.EOF && lines > 0) {
+			s, decodeErr := decodeBatch(batch, &bases)
+			if decodeErr != nil {
+				return fmt.Errorf("decoding %s: %w", name, decodeErr)
+			}
+			if len(s.Records) > 0 {
+				decodeErr = process(s)
+				if decodeErr != nil {
+					return decodeErr
+				}
+			}
+			batch = batch[:0]
+			lines = 0
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// decodeBatch decodes a batch of JSON lines and carries in the base fields in
+// effect before it. It validates the batch only then, since its records may
+// take their names from a base name sent in an earlier batch.
+func decodeBatch(batch []byte, bases *senml.SenMLRecord) (senml.SenML, error) {
+	s, err := decodeTimed(batch, senml.JSONLINE)
+	if err != nil && !errors.Is(err, senml.ErrNotValid) {
+		return s, err
+	}
+	if len(s.Records) == 0 {
+		return s, nil
+	}
+
+	carryBases(bases, s.Records)
+	if problems := senml.Validate(s); len(problems) > 0 {
+		return s, fmt.Errorf("%w: %v", senml.ErrNotValid, problems[0])
+	}
+	return s, nil
+}
+
+// carryBases fills in the base fields of the first record from those in
+// effect before it, and updates bases with those in effect after the records
+func carryBases(bases *senml.SenMLRecord, records []senml.SenMLRecord) {
+	first := &records[0]
+	if first.BaseName == "" {
+		first.BaseName = bases.BaseName
+	}
+	if first.BaseTime == 0 {
+		first.BaseTime = bases.BaseTime
+	}
+	if first.BaseUnit == "" {
+		first.BaseUnit = bases.BaseUnit
+	}
+	if first.BaseVersion == 0 {
+		first.BaseVersion = bases.BaseVersion
+	}
+
+	for _, r := range records {
+		if r.BaseName != "" {
+			bases.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			bases.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			bases.BaseUnit = r.BaseUnit
+		}
+		if r.BaseVersion != 0 {
+			bases.BaseVersion = r.BaseVersion
+		}
 	}
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/cisco/senml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var devices = flag.Int("devices", 1, "number of devices")
+var namePrefix = flag.String("prefix", "dev", "start of the device names, followed by the device number")
+var seriesSpec = flag.String("series", "", "series of each device as name:unit:shape:min:max[:period[:noise]] separated by commas, shape being sine, walk or step")
+var interval = flag.Float64("interval", 1, "seconds between samples")
+var packSamples = flag.Int("samples", 1, "samples of each series in a pack")
+var startTime = flag.Float64("start", 0, "time of the first sample, 0 for now")
+var doCompactPtr = flag.Bool("compact", false, "move the device name, time and a shared unit into base fields")
+var seed = flag.Int64("seed", 0, "seed for the random values, so runs can be repeated")
+
+var packCount = flag.Int("packs", 10, "number of packs to generate, 0 for no end")
+var rate = flag.Float64("rate", 0, "packs per second to emit, 0 for as fast as possible")
+var formatName = flag.String("format", "json", "output format: json, jsonl, xml, cbor, csv, mpack, linp, table, cbordiag or cborhex")
+var doIndentPtr = flag.Bool("i", false, "indent output")
+var topic = flag.String("topic", "senml", "InfluxDB series name for linp")
+var outputFile = flag.String("o", "", "append the packs to this file instead of writing them to stdout")
+var outputDir = flag.String("dir", "", "write each pack to its own file in this directory")
+var postUrl = flag.String("post", "", "URL to HTTP POST each pack to")
+
+// contentTypes are the media types packs are posted with
+var contentTypes = map[senml.Format]string{
+	senml.JSON:     "application/senml+json",
+	senml.XML:      "application/senml+xml",
+	senml.CBOR:     "application/senml+cbor",
+	senml.JSONLINE: "application/senml+json",
+	senml.LINEP:    "text/plain",
+	senml.CSV:      "text/csv",
+}
+
+// extensions are the extensions of the files written with -dir
+var extensions = map[senml.Format]string{
+	senml.JSON:     ".json",
+	senml.XML:      ".xml",
+	senml.CBOR:     ".cbor",
+	senml.CSV:      ".csv",
+	senml.MPACK:    ".mpack",
+	senml.LINEP:    ".linp",
+	senml.JSONLINE: ".jsonl",
+	senml.TABLE:    ".txt",
+	senml.CBORDIAG: ".diag",
+	senml.CBORHEX:  ".hex",
+}
+
+func post(data []byte, format senml.Format) error {
+	contentType, ok := contentTypes[format]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+
+	resp, err := http.Post(*postUrl, contentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("post got status %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// emit sends one encoded pack where the flags say
+func emit(n int, data []byte, format senml.Format, w io.Writer) error {
+	switch {
+	case *postUrl != "":
+		return post(data, format)
+
+	case *outputDir != "":
+		name := filepath.Join(*outputDir, fmt.Sprintf("pack-%06d%s", n, extensions[format]))
+		return ioutil.WriteFile(name, data, 0644)
+	}
+
+	_, err := w.Write(data)
+	if err == nil && format != senml.CBOR && format != senml.MPACK && !bytes.HasSuffix(data, []byte("\n")) {
+		// one text pack per line
+		_, err = w.Write([]byte("\n"))
+	}
+	return err
+}
+
+func run() error {
+	format, err := senml.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	options := senml.GenerateOptions{
+		Devices:     *devices,
+		NamePrefix:  *namePrefix,
+		Start:       *startTime,
+		Interval:    *interval,
+		PackSamples: *packSamples,
+		Compact:     *doCompactPtr,
+		Seed:        *seed,
+	}
+	if *seriesSpec != "" {
+		options.Series, err = senml.ParseSeries(*seriesSpec)
+		if err != nil {
+			return err
+		}
+	}
+	g, err := senml.NewGenerator(options)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputFile != "" {
+		f, err := os.OpenFile(*outputFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	if *outputDir != "" {
+		err = os.MkdirAll(*outputDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	var tick <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for n := 1; *packCount == 0 || n <= *packCount; n++ {
+		data, err := senml.Encode(g.Next(), format, senml.OutputOptions{PrettyPrint: *doIndentPtr, Topic: *topic})
+		if err != nil {
+			return err
+		}
+		if tick != nil {
+			<-tick
+		}
+		err = emit(n, data, format, w)
+		if err != nil {
+			return err
+		}
+		if tick != nil {
+			// let a reader at the other end of a pipe see each pack as it goes
+			err = w.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "senmlGen:", err)
+		os.Exit(1)
+	}
+}
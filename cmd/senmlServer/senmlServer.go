@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"expvar"
 	"flag"
 	"fmt"
 	"github.com/cisco/senml"
+	"github.com/cisco/senml/cose"
+	"github.com/cisco/senml/jose"
 	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 	"log"
 )
@@ -32,6 +37,7 @@ var doPrintPtr = flag.Bool("print", false, "print output to stdout")
 var doExpandPtr = flag.Bool("expand", false, "expand SenML records")
 
 var httpPort = flag.Int("http", 0, "port to list for http on")
+var metricsAddr = flag.String("metrics", "", "address to serve the counters at /debug/vars on, such as 127.0.0.1:8881, kept apart from the http port")
 var postUrl = flag.String("post", "", "URL to HTTP POST output to")
 var kafkaUrl = flag.String("kafka", "", "URL to for Apache Kafka Broker to send data to")
 
@@ -43,26 +49,54 @@ var doXmlPtr = flag.Bool("xml", false, "output XML formatted SenML ")
 var doCsvPtr = flag.Bool("csv", false, "output CSV formatted SenML ")
 var doMpackPtr = flag.Bool("mpack", false, "output MessagePack formatted SenML ")
 var doLinpPtr = flag.Bool("linp", false, "output InfluxDB LineProtcol formatted SenML ")
+var doCanonicalPtr = flag.Bool("canonical", false, "output CBOR in the deterministic encoding of RFC 8949")
+var cborFloatBits = flag.Int("floatbits", 64, "precision of values output as CBOR, 32 or 64 bits")
 
 var doIJsonStreamPtr = flag.Bool("ijsons", false, "input JSON formatted SenML stream")
 var doIJsonLinePtr = flag.Bool("ijsonl", false, "input JSON formatted SenML lines")
 var doIXmlPtr = flag.Bool("ixml", false, "input XML formatted SenML ")
 var doICborPtr = flag.Bool("icbor", false, "input CBOR formatted SenML ")
 var doIMpackPtr = flag.Bool("impack", false, "input MessagePack formatted SenML ")
+var doLenientPtr = flag.Bool("lenient", false, "accept draft-era SenML field names and encodings")
+var maxBytes = flag.Int("maxbytes", 1<<20, "largest SenML message accepted in bytes, 0 for no limit")
+var maxRecords = flag.Int("maxrecords", 0, "most records accepted in a SenML message, 0 for no limit")
+var maxNameLen = flag.Int("maxname", 0, "longest resolved SenML name accepted, 0 for no limit")
+var maxValueLen = flag.Int("maxvalue", 0, "longest SenML string or data value accepted, 0 for no limit")
+var doSkipBadPtr = flag.Bool("skipbad", false, "skip JSON lines that can not be decoded")
+var doStrictPtr = flag.Bool("strict", false, "reject SenML with unknown or duplicate fields, wrong types or trailing data")
+var verifyKeyFile = flag.String("verify", "", "only accept CBOR SenML in COSE_Sign1 or COSE_Mac0, or JSON SenML in a JWS, that checks with the key in this file")
+var decryptKeyFile = flag.String("decrypt", "", "decrypt posted COSE_Encrypt0 or JWE messages with the key in this file")
+var encryptKeyFile = flag.String("encrypt", "", "forward CBOR SenML in COSE_Encrypt0 using the hex key in this file")
+var encryptAlg = flag.Int("encalg", cose.AESCCM16_64_128, "COSE algorithm number used with -encrypt")
+var encryptKid = flag.String("enckid", "", "key identifier to put in encrypted output")
+
+var pipelineSpec = flag.String("pipeline", "", "filter and transform records, such as \"name room1/*; scale */temp 1.8 32\"")
+var pipelineFile = flag.String("pipelinefile", "", "file holding a pipeline to filter and transform records")
+var doDedupPtr = flag.Bool("dedup", false, "drop records already seen with the same name and time")
+var dedupWindow = flag.Float64("dedupwindow", 0, "seconds back from the newest record to look for duplicates, 0 for no limit")
+var dedupMax = flag.Int("dedupmax", 100000, "most records remembered for -dedup, 0 for no limit")
+var doDedupValuePtr = flag.Bool("dedupvalue", false, "with -dedup, records with different values are not duplicates")
+
+var verifyKey interface{} = nil
+var decryptKey interface{} = nil
+var encryptKey []byte = nil
+
+var pipeline senml.Pipeline = nil
+
+// codec is shared by the goroutines handling requests
+var codec *senml.Codec = nil
 
 var kafkaConn net.Conn = nil
 var kafkaReqNumber uint32 = 1
 
-func decodeTimed(msg []byte) (senml.SenML, error) {
-	var s senml.SenML
-	var err error
-
+// inputFormat returns the format picked by the input flags
+func inputFormat() senml.Format {
 	var format senml.Format = senml.JSON
 	switch {
 	case *doIJsonStreamPtr:
 		format = senml.JSON
 	case *doIJsonLinePtr:
-		format = senml.JSON
+		format = senml.JSONLINE
 	case *doICborPtr:
 		format = senml.CBOR
 	case *doIXmlPtr:
@@ -71,7 +105,32 @@ func decodeTimed(msg []byte) (senml.SenML, error) {
 		format = senml.MPACK
 	}
 
-	s, err = senml.Decode(msg, format) // TODO
+	return format
+}
+
+func decodeTimed(msg []byte, format senml.Format) (senml.SenML, error) {
+	var s senml.SenML
+	var err error
+
+	var report senml.DecodeReport
+	options := senml.DecodeOptions{
+		Lenient:        *doLenientPtr,
+		Strict:         *doStrictPtr,
+		MaxBytes:       *maxBytes,
+		MaxRecords:     *maxRecords,
+		MaxNameLength:  *maxNameLen,
+		MaxValueLength: *maxValueLen,
+		SkipBadLines:   *doSkipBadPtr,
+	}
+	s, report, err = codec.DecodeWithOptions(msg, format, options)
+	if *doVerbosePtr && len(report.Legacy) > 0 {
+		fmt.Println("Legacy SenML seen:", strings.Join(report.Legacy, ", "))
+	}
+	for _, lineErr := range report.Skipped {
+		if *doVerbosePtr {
+			fmt.Println("Skipped", lineErr)
+		}
+	}
 
 	return s, err
 }
@@ -311,13 +370,13 @@ func outputData(data []byte) error {
 	return nil
 }
 
-func processData(dataIn []byte) error {
+func processData(dataIn []byte, inFormat senml.Format) error {
 	var s senml.SenML
 	var err error
 
 	//fmt.Println( "DataIn:", dataIn )
 
-	s, err = decodeTimed(dataIn)
+	s, err = decodeTimed(dataIn, inFormat)
 	if err != nil {
 		fmt.Println("Decode of SenML failed")
 		return err
@@ -328,6 +387,18 @@ func processData(dataIn []byte) error {
 		s = senml.Normalize(s)
 	}
 
+	if pipeline != nil {
+		s, err = pipeline.Apply(s)
+		if err != nil {
+			fmt.Println("Pipeline failed")
+			return err
+		}
+	}
+	if len(s.Records) == 0 {
+		// everything was filtered out or was a duplicate
+		return nil
+	}
+
 	var dataOut []byte
 
 	options := senml.OutputOptions{}
@@ -352,7 +423,15 @@ func processData(dataIn []byte) error {
 		format = senml.LINEP
 	}
 
-	dataOut, err = senml.Encode(s, format, options)
+	if encryptKey != nil {
+		// encoded with the codec so -canonical and -floatbits hold inside
+		dataOut, err = codec.Encode(s, senml.CBOR, options)
+		if err == nil {
+			dataOut, err = cose.EncryptPayload(dataOut, *encryptAlg, encryptKey, []byte(*encryptKid))
+		}
+	} else {
+		dataOut, err = codec.Encode(s, format, options)
+	}
 	if err != nil {
 		fmt.Println("Encode of SenML failed")
 		return err
@@ -367,32 +446,166 @@ func processData(dataIn []byte) error {
 	return nil
 }
 
+// toSymmetricKey returns the key bytes, or nil so decryption fails for a key
+// that is not symmetric
+func toSymmetricKey(key interface{}) []byte {
+	b, _ := key.([]byte)
+	return b
+}
+
+// readSymmetricKey reads a hex key from a file, or returns nil when no file
+// is named
+func readSymmetricKey(name string) ([]byte, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+	key, err := cose.ReadKeyFile(name)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := key.([]byte)
+	if !ok {
+		return nil, errors.New("key in " + name + " is not a symmetric key")
+	}
+	return b, nil
+}
+
 func httpReqHandler(w http.ResponseWriter, r *http.Request) {
 	//fmt.Println( "HTTP request to ",  r.URL.Path )
 	//fmt.Println( "Method: ",  r.Method )
 
 	// defer r.Body.Close() // not needed
 
-	body, err := ioutil.ReadAll(r.Body)
+	// read one byte past the limit to tell if the body is too large
+	var reader io.Reader = r.Body
+	if *maxBytes > 0 {
+		reader = io.LimitReader(r.Body, int64(*maxBytes)+1)
+	}
+	body, err := ioutil.ReadAll(reader)
 	if err != nil {
-		panic("Problem reading HTTP body")
+		http.Error(w, "Problem reading HTTP body", 400)
+		return
+	}
+	if *maxBytes > 0 && len(body) > *maxBytes {
+		http.Error(w, "SenML message too large", 413)
+		return
 	}
 
 	if *doVerbosePtr {
 		fmt.Println("HTTP Body: ", body)
 	}
 
-	err = processData(body)
-	if err != nil {
+	// COSE carries CBOR SenML and JOSE carries JSON SenML
+	format := inputFormat()
+	if decryptKey != nil {
+		if jose.IsJWE(body) {
+			body, err = jose.Decrypt(string(body), decryptKey)
+			format = senml.JSON
+		} else {
+			body, err = cose.Decrypt(body, toSymmetricKey(decryptKey))
+			format = senml.CBOR
+		}
+		if err != nil {
+			http.Error(w, "SenML could not be decrypted: "+err.Error(), 400)
+			return
+		}
+	}
+	if verifyKey != nil {
+		if jose.IsJWS(body) {
+			body, err = jose.Verify(string(body), verifyKey)
+			format = senml.JSON
+		} else {
+			body, err = cose.Verify(body, verifyKey)
+			format = senml.CBOR
+		}
+		if err != nil {
+			http.Error(w, "SenML not signed or signature bad: "+err.Error(), 401)
+			return
+		}
+	}
+
+	err = processData(body, format)
+	if errors.Is(err, senml.ErrLimitExceeded) {
+		http.Error(w, err.Error(), 413)
+	} else if err != nil {
 		http.Error(w, err.Error(), 400)
 	}
 }
 
+// loadPipeline builds the pipeline named by the flags, or nil for none
+func loadPipeline() (senml.Pipeline, error) {
+	var p senml.Pipeline
+
+	if len(*pipelineFile) != 0 {
+		filePipeline, err := senml.ReadPipelineFile(*pipelineFile)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, filePipeline...)
+	}
+	if len(*pipelineSpec) != 0 {
+		flagPipeline, err := senml.ParsePipeline(*pipelineSpec)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, flagPipeline...)
+	}
+	if *doDedupPtr {
+		dedup := senml.NewDeduplicator(senml.DedupOptions{
+			Window:     *dedupWindow,
+			MaxEntries: *dedupMax,
+			MatchValue: *doDedupValuePtr,
+		})
+		// the counts show up in /debug/vars on the -metrics address
+		expvar.Publish("senmlDuplicatesDropped", expvar.Func(func() interface{} { return dedup.Dropped() }))
+		expvar.Publish("senmlRecordsPassed", expvar.Func(func() interface{} { return dedup.Passed() }))
+		p = append(p, dedup)
+	}
+
+	return p, nil
+}
+
 func main() {
 	var err error
 
 	flag.Parse()
 
+	codec, err = senml.NewCodec(senml.CodecOptions{
+		CanonicalCBOR: *doCanonicalPtr,
+		CBORFloatBits: *cborFloatBits,
+	})
+	if err != nil {
+		fmt.Println("error in options", err)
+		os.Exit(1)
+	}
+
+	pipeline, err = loadPipeline()
+	if err != nil {
+		fmt.Println("error in pipeline", err)
+		os.Exit(1)
+	}
+
+	if len(*verifyKeyFile) != 0 {
+		verifyKey, err = cose.ReadKeyFile(*verifyKeyFile)
+		if err != nil {
+			fmt.Println("error reading key file", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*decryptKeyFile) != 0 {
+		decryptKey, err = cose.ReadKeyFile(*decryptKeyFile)
+		if err != nil {
+			fmt.Println("error reading decryption key", err)
+			os.Exit(1)
+		}
+	}
+	encryptKey, err = readSymmetricKey(*encryptKeyFile)
+	if err != nil {
+		fmt.Println("error reading encryption key", err)
+		os.Exit(1)
+	}
+
 	if len(*kafkaUrl) != 0 {
 		kafkaConn, err = net.DialTimeout("tcp", *kafkaUrl, 2500*time.Millisecond)
 		if err != nil {
@@ -402,7 +615,18 @@ func main() {
 		defer kafkaConn.Close()
 	}
 
-	http.HandleFunc("/", httpReqHandler)
-	err = http.ListenAndServe(":"+strconv.Itoa(*httpPort), nil)
+	if len(*metricsAddr) != 0 {
+		// expvar registers on the default mux, so posts are taken on a
+		// mux of their own
+		metrics := http.NewServeMux()
+		metrics.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, metrics))
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", httpReqHandler)
+	err = http.ListenAndServe(":"+strconv.Itoa(*httpPort), mux)
 	log.Fatal( err )
 }
@@ -0,0 +1,107 @@
+package senml
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// CodecOptions configures a Codec. The zero value writes what Encode writes.
+type CodecOptions struct {
+	// CanonicalCBOR writes CBOR in the core deterministic encoding of RFC
+	// 8949 section 4.2.1, with the labels of each record in the order of
+	// their encoded bytes, 0 to 8 then -1 to -4, and each number in the
+	// shortest float that holds it exactly. Signatures made over CBOR can
+	// then be checked after it is decoded and encoded again elsewhere.
+	CanonicalCBOR bool
+
+	// CBORFloatBits is the precision values and sums are written in as
+	// CBOR, 32 or 64 bits, with zero meaning 64. Single precision keeps
+	// about seven digits in half the bytes. Times keep 64 bits since 32 can
+	// not hold them to the second.
+	CBORFloatBits int
+}
+
+// Codec encodes and decodes SenML with its own options, keeping the handles
+// of the codec package and the buffers it uses from one call to the next.
+// It is safe for concurrent use, so a server can share one between the
+// goroutines handling its requests.
+type Codec struct {
+	options CodecOptions
+
+	cborHandle  *codec.CborHandle
+	mpackHandle *codec.MsgpackHandle
+	// rawHandle reads the MessagePack strings sent as raw bytes by older
+	// encoders, for lenient decoding
+	rawHandle *codec.MsgpackHandle
+
+	cborDecoders  sync.Pool
+	mpackDecoders sync.Pool
+	mpackEncoders sync.Pool
+}
+
+// defaultCodec serves Encode, Decode and DecodeWithOptions
+var defaultCodec = newCodec(CodecOptions{})
+
+// NewCodec returns a Codec with the options, or an error for options it does
+// not support
+func NewCodec(options CodecOptions) (*Codec, error) {
+	switch options.CBORFloatBits {
+	case 0, 32, 64:
+	default:
+		return nil, fmt.Errorf("CBOR floats of %d bits not supported, only 32 or 64", options.CBORFloatBits)
+	}
+	return newCodec(options), nil
+}
+
+func newCodec(options CodecOptions) *Codec {
+	c := &Codec{
+		options:     options,
+		cborHandle:  new(codec.CborHandle),
+		mpackHandle: new(codec.MsgpackHandle),
+		rawHandle:   new(codec.MsgpackHandle),
+	}
+	c.rawHandle.RawToString = true
+
+	c.cborDecoders.New = func() interface{} {
+		return codec.NewDecoderBytes(nil, c.cborHandle)
+	}
+	c.mpackDecoders.New = func() interface{} {
+		return codec.NewDecoderBytes(nil, c.mpackHandle)
+	}
+	c.mpackEncoders.New = func() interface{} {
+		return codec.NewEncoderBytes(nil, c.mpackHandle)
+	}
+	return c
+}
+
+// noBytes is given to pooled decoders once done so they do not hold on to
+// the message
+var noBytes = []byte{}
+
+// decode decodes msg into v with a decoder from pool
+func decode(pool *sync.Pool, msg []byte, v interface{}) error {
+	d := pool.Get().(*codec.Decoder)
+	d.ResetBytes(msg)
+	err := d.Decode(v)
+	d.ResetBytes(noBytes)
+	pool.Put(d)
+	return err
+}
+
+// encodeMsgpack appends records as MessagePack
+func (c *Codec) encodeMsgpack(b []byte, records []SenMLRecord) ([]byte, error) {
+	e := c.mpackEncoders.Get().(*codec.Encoder)
+	e.ResetBytes(&b)
+	err := e.Encode(records)
+	c.mpackEncoders.Put(e)
+	return b, err
+}
+
+func (c *Codec) cborOptions() cborOptions {
+	return cborOptions{
+		canonical: c.options.CanonicalCBOR,
+		float32:   c.options.CBORFloatBits == 32,
+	}
+}
@@ -0,0 +1,125 @@
+package senml_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestCodecDefault(t *testing.T) {
+	c, err := senml.NewCodec(senml.CodecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packs, err := senml.Generate(senml.GenerateOptions{Start: 1600000000, PackSamples: 3, Compact: true, Seed: 1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := packs[0]
+	on, sum := true, 12.5
+	s.Records = append(s.Records,
+		senml.SenMLRecord{Name: "state", StringValue: "open"},
+		senml.SenMLRecord{Name: "alarm", BoolValue: &on, Sum: &sum},
+		senml.SenMLRecord{Name: "blob", DataValue: "aGk"},
+	)
+	for _, format := range []senml.Format{senml.JSON, senml.XML, senml.CBOR, senml.CSV, senml.MPACK, senml.LINEP, senml.JSONLINE, senml.TABLE, senml.CBORDIAG, senml.CBORHEX} {
+		want, err := senml.Encode(s, format, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Encode(s, format, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: codec wrote %q, Encode %q", format, got, want)
+		}
+	}
+}
+
+func TestCodecCBOROptions(t *testing.T) {
+	v := 1.5
+	w := 22.1
+	s := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "a", Name: "t", Value: &v},
+		{Name: "u", Time: -10, Value: &w},
+	}}
+
+	cases := []struct {
+		options senml.CodecOptions
+		hex     string
+	}{
+		{senml.CodecOptions{}, "82a3216161006174" + "02fb3ff8000000000000" + "a3006175" + "02fb403619999999999a" + "06fbc024000000000000"},
+		{senml.CodecOptions{CanonicalCBOR: true}, "82a3006174" + "02f93e00" + "216161" + "a3006175" + "02fb403619999999999a" + "06f9c900"},
+		{senml.CodecOptions{CBORFloatBits: 32}, "82a3216161006174" + "02fa3fc00000" + "a3006175" + "02fa41b0cccd" + "06fbc024000000000000"},
+		{senml.CodecOptions{CanonicalCBOR: true, CBORFloatBits: 32}, "82a3006174" + "02f93e00" + "216161" + "a3006175" + "02fa41b0cccd" + "06f9c900"},
+	}
+	for _, c := range cases {
+		codec, err := senml.NewCodec(c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := codec.Encode(s, senml.CBOR, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(data) != c.hex {
+			t.Errorf("%+v: got %x, want %s", c.options, data, c.hex)
+		}
+
+		back, err := codec.Decode(data, senml.CBOR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *back.Records[0].Value != 1.5 || back.Records[1].Time != -10 || back.Records[1].Name != "u" {
+			t.Errorf("%+v: decoded %+v", c.options, back.Records)
+		}
+	}
+
+	_, err := senml.NewCodec(senml.CodecOptions{CBORFloatBits: 16})
+	if err == nil {
+		t.Error("16 bit floats accepted")
+	}
+}
+
+func TestCodecConcurrent(t *testing.T) {
+	c, err := senml.NewCodec(senml.CodecOptions{CanonicalCBOR: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packs, err := senml.Generate(senml.GenerateOptions{Devices: 8, Start: 1600000000, PackSamples: 5, Seed: 1}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range packs {
+		wg.Add(1)
+		go func(s senml.SenML) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for _, format := range []senml.Format{senml.CBOR, senml.MPACK, senml.JSON} {
+					data, err := c.Encode(s, format, senml.OutputOptions{})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					back, err := c.Decode(data, format)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if back.Records[0].Name != s.Records[0].Name || len(back.Records) != len(s.Records) {
+						t.Errorf("%v: decoded %+v, encoded %+v", format, back.Records[0], s.Records[0])
+						return
+					}
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+}
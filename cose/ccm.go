@@ -0,0 +1,166 @@
+package cose
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// ccm implements AES-CCM (RFC 3610), which the standard library lacks
+type ccm struct {
+	block     cipher.Block
+	tagSize   int
+	nonceSize int
+}
+
+func newCCM(block cipher.Block, tagSize int, nonceSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("CCM needs a 128-bit block cipher")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, errors.New("bad CCM tag size")
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("bad CCM nonce size")
+	}
+	return &ccm{block: block, tagSize: tagSize, nonceSize: nonceSize}, nil
+}
+
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+// maxLength is the longest message the length field can hold
+func (c *ccm) maxLength() uint64 {
+	l := 15 - c.nonceSize
+	if l >= 8 {
+		return 1<<63 - 1
+	}
+	return 1<<(8*uint(l)) - 1
+}
+
+// counter returns counter block i
+func (c *ccm) counter(nonce []byte, i uint64) []byte {
+	var a [16]byte
+
+	l := 15 - c.nonceSize
+	a[0] = byte(l - 1)
+	copy(a[1:], nonce)
+	for j := 15; j > c.nonceSize; j-- {
+		a[j] = byte(i)
+		i >>= 8
+	}
+	return a[:]
+}
+
+// ctr encrypts or decrypts src into dst with the counter blocks from 1 up
+func (c *ccm) ctr(dst []byte, src []byte, nonce []byte) {
+	var s [16]byte
+
+	for i := 0; i < len(src); i += 16 {
+		c.block.Encrypt(s[:], c.counter(nonce, uint64(i/16+1)))
+		end := i + 16
+		if end > len(src) {
+			end = len(src)
+		}
+		xorBytes(dst[i:end], src[i:end], s[:end-i])
+	}
+}
+
+// mac computes the CBC-MAC tag of the plaintext and additional data,
+// encrypted with counter block 0
+func (c *ccm) mac(nonce []byte, plaintext []byte, data []byte) []byte {
+	var x [16]byte
+	var b [16]byte
+
+	l := 15 - c.nonceSize
+	b[0] = byte((c.tagSize-2)/2<<3 | (l - 1))
+	if len(data) > 0 {
+		b[0] |= 0x40
+	}
+	copy(b[1:], nonce)
+	n := uint64(len(plaintext))
+	for j := 15; j > c.nonceSize; j-- {
+		b[j] = byte(n)
+		n >>= 8
+	}
+	c.block.Encrypt(x[:], b[:])
+
+	// the additional data starts with its length and is padded with zeros
+	if len(data) > 0 {
+		var head []byte
+		if len(data) < 0xff00 {
+			head = make([]byte, 2)
+			binary.BigEndian.PutUint16(head, uint16(len(data)))
+		} else {
+			head = []byte{0xff, 0xfe, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(head[2:], uint32(len(data)))
+		}
+		c.cbc(&x, append(head, data...))
+	}
+	c.cbc(&x, plaintext)
+
+	var s [16]byte
+	c.block.Encrypt(s[:], c.counter(nonce, 0))
+	xorBytes(x[:], x[:], s[:])
+
+	return x[:c.tagSize]
+}
+
+// cbc chains the zero padded blocks of data into x
+func (c *ccm) cbc(x *[16]byte, data []byte) {
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		xorBytes(x[:end-i], x[:end-i], data[i:end])
+		c.block.Encrypt(x[:], x[:])
+	}
+}
+
+func (c *ccm) Seal(dst []byte, nonce []byte, plaintext []byte, data []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("cose: wrong CCM nonce length")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("cose: message too long for CCM")
+	}
+
+	tag := c.mac(nonce, plaintext, data)
+	out := make([]byte, len(plaintext), len(plaintext)+c.tagSize)
+	c.ctr(out, plaintext, nonce)
+	out = append(out, tag...)
+
+	return append(dst, out...)
+}
+
+func (c *ccm) Open(dst []byte, nonce []byte, ciphertext []byte, data []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize || len(ciphertext) < c.tagSize {
+		return nil, errors.New("cose: message authentication failed")
+	}
+	if uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, errors.New("cose: message authentication failed")
+	}
+
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	plaintext := make([]byte, len(ciphertext)-c.tagSize)
+	c.ctr(plaintext, ciphertext[:len(plaintext)], nonce)
+	if subtle.ConstantTimeCompare(c.mac(nonce, plaintext, data), tag) != 1 {
+		return nil, errors.New("cose: message authentication failed")
+	}
+
+	return append(dst, plaintext...), nil
+}
+
+// xorBytes sets dst to a xor b, which must be the same length
+func xorBytes(dst []byte, a []byte, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
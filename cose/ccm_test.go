@@ -0,0 +1,164 @@
+package cose
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// ccmVectors are RFC 3610 packet vectors #1 to #3, with the 13 byte nonce
+// and 8 byte tag of AES-CCM-16-64-128, the examples 1 to 3 of NIST SP
+// 800-38C, with nonces of 7, 8 and 12 bytes, and two vectors made with
+// OpenSSL for the 256-bit keys and 16 byte tags of AES-CCM-16-128-256 and
+// AES-CCM-64-128-256
+var ccmVectors = []struct {
+	name       string
+	key        string
+	nonce      string
+	aad        string
+	plaintext  string
+	tagSize    int
+	ciphertext string
+}{
+	{
+		name:       "RFC 3610 #1",
+		key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:      "00000003020100a0a1a2a3a4a5",
+		aad:        "0001020304050607",
+		plaintext:  "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+		tagSize:    8,
+		ciphertext: "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0",
+	},
+	{
+		name:       "RFC 3610 #2",
+		key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:      "00000004030201a0a1a2a3a4a5",
+		aad:        "0001020304050607",
+		plaintext:  "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		tagSize:    8,
+		ciphertext: "72c91a36e135f8cf291ca894085c87e3cc15c439c9e43a3ba091d56e10400916",
+	},
+	{
+		name:       "RFC 3610 #3",
+		key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:      "00000005040302a0a1a2a3a4a5",
+		aad:        "0001020304050607",
+		plaintext:  "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+		tagSize:    8,
+		ciphertext: "51b1e5f44a197d1da46b0f8e2d282ae871e838bb64da8596574adaa76fbd9fb0c5",
+	},
+	{
+		name:       "SP 800-38C example 1",
+		key:        "404142434445464748494a4b4c4d4e4f",
+		nonce:      "10111213141516",
+		aad:        "0001020304050607",
+		plaintext:  "20212223",
+		tagSize:    4,
+		ciphertext: "7162015b4dac255d",
+	},
+	{
+		name:       "SP 800-38C example 2",
+		key:        "404142434445464748494a4b4c4d4e4f",
+		nonce:      "1011121314151617",
+		aad:        "000102030405060708090a0b0c0d0e0f",
+		plaintext:  "202122232425262728292a2b2c2d2e2f",
+		tagSize:    6,
+		ciphertext: "d2a1f0e051ea5f62081a7792073d593d1fc64fbfaccd",
+	},
+	{
+		name:       "SP 800-38C example 3",
+		key:        "404142434445464748494a4b4c4d4e4f",
+		nonce:      "101112131415161718191a1b",
+		aad:        "000102030405060708090a0b0c0d0e0f10111213",
+		plaintext:  "202122232425262728292a2b2c2d2e2f3031323334353637",
+		tagSize:    8,
+		ciphertext: "e3b201a9f5b71a7a9b1ceaeccd97e70b6176aad9a4428aa5484392fbc1b09951",
+	},
+	{
+		name:       "AES-CCM-16-128-256",
+		key:        "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		nonce:      "101112131415161718191a1b1c",
+		aad:        "0001020304050607",
+		plaintext:  "202122232425262728292a2b2c2d2e2f303132333435363738",
+		tagSize:    16,
+		ciphertext: "3d936ecbf38a505f4f09bdb7821b5e67722d861f18e4c0dfe7d5e3aa673f7e5f3b617ab57677c6eb47",
+	},
+	{
+		name:       "AES-CCM-64-128-256",
+		key:        "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		nonce:      "10111213141516",
+		aad:        "0001020304050607",
+		plaintext:  "202122232425262728292a2b2c2d2e2f303132333435363738",
+		tagSize:    16,
+		ciphertext: "241627d535c443cdd9dfe6ecdb8f1dede3d0bc514fbd4cd89caeaac3541e21b5fb41fb1174f02026f5",
+	},
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCCM(t *testing.T) {
+	for _, v := range ccmVectors {
+		key, nonce, aad := unhex(t, v.key), unhex(t, v.nonce), unhex(t, v.aad)
+		plaintext, want := unhex(t, v.plaintext), unhex(t, v.ciphertext)
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := newCCM(block, v.tagSize, len(nonce))
+		if err != nil {
+			t.Fatal(v.name, err)
+		}
+		got := c.Seal(nil, nonce, plaintext, aad)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: CCM Seal got %x", v.name, got)
+		}
+
+		opened, err := c.Open(nil, nonce, want, aad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("%s: CCM Open got %x, %v", v.name, opened, err)
+		}
+	}
+}
+
+func TestCCMTampered(t *testing.T) {
+	v := ccmVectors[0]
+	block, err := aes.NewCipher(unhex(t, v.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newCCM(block, v.tagSize, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, aad := unhex(t, v.nonce), unhex(t, v.aad)
+
+	// a change to the ciphertext, each byte of the tag or the data must be
+	// caught
+	ciphertext := unhex(t, v.ciphertext)
+	for i := range ciphertext {
+		changed := append([]byte{}, ciphertext...)
+		changed[i] ^= 0x80
+		if _, err := c.Open(nil, nonce, changed, aad); err == nil {
+			t.Error("CCM Open of a message changed at byte", i, "should fail")
+		}
+	}
+	changed := append([]byte{}, aad...)
+	changed[0] ^= 1
+	if _, err := c.Open(nil, nonce, ciphertext, changed); err == nil {
+		t.Error("CCM Open with changed data should fail")
+	}
+	if _, err := c.Open(nil, nonce, ciphertext[:len(ciphertext)-1], aad); err == nil {
+		t.Error("CCM Open of a cut message should fail")
+	}
+	if _, err := c.Open(nil, nonce, ciphertext[:v.tagSize-1], aad); err == nil {
+		t.Error("CCM Open of less than a tag should fail")
+	}
+}
@@ -0,0 +1,369 @@
+// Package cose protects CBOR encoded SenML packs with COSE (RFC 8152). Packs
+// can be signed with COSE_Sign1, authenticated with COSE_Mac0 and encrypted
+// with COSE_Encrypt0. Keys are supplied by the caller.
+package cose
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/cisco/senml"
+	"github.com/ugorji/go/codec"
+)
+
+// COSE algorithm identifiers
+const (
+	ES256   = -7
+	EdDSA   = -8
+	HMAC256 = 5
+)
+
+// COSE message tags
+const (
+	tagEncrypt0 = 16
+	tagMac0     = 17
+	tagSign1    = 18
+)
+
+// COSE header labels
+const (
+	headerAlg = 1
+	headerKid = 4
+	headerIV  = 5
+)
+
+var ErrNotCOSE = errors.New("not a tagged COSE message")
+var ErrVerify = errors.New("COSE signature or MAC does not verify")
+var ErrKeyType = errors.New("key type not supported for this COSE message")
+
+// message holds the parts common to the COSE messages
+type message struct {
+	tag         byte
+	protected   []byte
+	unprotected map[interface{}]interface{}
+	payload     []byte
+	extra       []byte
+}
+
+func encodeCBOR(v interface{}) ([]byte, error) {
+	var data []byte
+
+	var cborHandle = new(codec.CborHandle)
+	cborHandle.Canonical = true
+	err := codec.NewEncoderBytes(&data, cborHandle).Encode(v)
+
+	return data, err
+}
+
+// encodeMessage writes a tagged COSE message. The extra part is the
+// signature or tag and is left out of COSE_Encrypt0, which carries an IV.
+func encodeMessage(m message, kid []byte, iv []byte) ([]byte, error) {
+	unprotected := map[int]interface{}{}
+	if len(kid) > 0 {
+		unprotected[headerKid] = kid
+	}
+	if len(iv) > 0 {
+		unprotected[headerIV] = iv
+	}
+
+	parts := []interface{}{m.protected, unprotected, m.payload}
+	if m.tag != tagEncrypt0 {
+		parts = append(parts, m.extra)
+	}
+	data, err := encodeCBOR(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{0xc0 | m.tag}, data...), nil
+}
+
+func decodeMessage(msg []byte) (message, error) {
+	var m message
+	var parts []interface{}
+
+	if !IsCOSE(msg) {
+		return m, ErrNotCOSE
+	}
+	m.tag = msg[0] & 0x1f
+
+	var cborHandle = new(codec.CborHandle)
+	err := codec.NewDecoderBytes(msg[1:], cborHandle).Decode(&parts)
+	if err != nil {
+		return m, err
+	}
+	want := 4
+	if m.tag == tagEncrypt0 {
+		want = 3
+	}
+	if len(parts) != want {
+		return m, fmt.Errorf("COSE message has %d parts, not %d", len(parts), want)
+	}
+
+	var ok bool
+	if m.protected, ok = parts[0].([]byte); !ok {
+		return m, errors.New("COSE protected header is not a byte string")
+	}
+	if m.unprotected, ok = parts[1].(map[interface{}]interface{}); !ok {
+		return m, errors.New("COSE unprotected header is not a map")
+	}
+	if m.payload, ok = parts[2].([]byte); !ok {
+		return m, errors.New("COSE payload is missing")
+	}
+	if want == 4 {
+		if m.extra, ok = parts[3].([]byte); !ok {
+			return m, errors.New("COSE signature or tag is not a byte string")
+		}
+	}
+
+	return m, nil
+}
+
+// header looks a label up in the given header map
+func header(h map[interface{}]interface{}, label int) (interface{}, bool) {
+	for k, v := range h {
+		switch n := k.(type) {
+		case int64:
+			if n == int64(label) {
+				return v, true
+			}
+		case uint64:
+			if label >= 0 && n == uint64(label) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func protectedHeader(alg int) ([]byte, error) {
+	return encodeCBOR(map[int]int{headerAlg: alg})
+}
+
+// alg returns the algorithm named in the protected header of the message
+func (m message) alg() (int, error) {
+	var h map[interface{}]interface{}
+
+	if len(m.protected) > 0 {
+		var cborHandle = new(codec.CborHandle)
+		err := codec.NewDecoderBytes(m.protected, cborHandle).Decode(&h)
+		if err != nil {
+			return 0, err
+		}
+	}
+	v, ok := header(h, headerAlg)
+	if !ok {
+		return 0, errors.New("COSE message has no protected algorithm")
+	}
+	switch n := v.(type) {
+	case int64:
+		return int(n), nil
+	case uint64:
+		return int(n), nil
+	}
+	return 0, errors.New("COSE algorithm is not an integer")
+}
+
+// KeyID returns the key identifier carried by a COSE message, if any, so the
+// caller can pick the key to check it with.
+func KeyID(msg []byte) ([]byte, error) {
+	m, err := decodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := header(m.unprotected, headerKid)
+	b, _ := kid.([]byte)
+	return b, nil
+}
+
+// toBeSigned builds the Sig_structure or MAC_structure for a message
+func toBeSigned(context string, protected []byte, payload []byte) ([]byte, error) {
+	return encodeCBOR([]interface{}{context, protected, []byte{}, payload})
+}
+
+// Sign encodes the pack as CBOR and signs it with COSE_Sign1. The key must be
+// an ECDSA P-256 key, for ES256, or an Ed25519 key, for EdDSA. The kid, when
+// not empty, goes in the unprotected header.
+func Sign(s senml.SenML, key interface{}, kid []byte) ([]byte, error) {
+	payload, err := senml.Encode(s, senml.CBOR, senml.OutputOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return SignPayload(payload, key, kid)
+}
+
+// SignPayload is like Sign for a payload that is already encoded.
+func SignPayload(payload []byte, key interface{}, kid []byte) ([]byte, error) {
+	var alg int
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrKeyType
+		}
+		alg = ES256
+	case ed25519.PrivateKey:
+		alg = EdDSA
+	default:
+		return nil, ErrKeyType
+	}
+
+	m := message{tag: tagSign1, payload: payload}
+	var err error
+	m.protected, err = protectedHeader(alg)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := toBeSigned("Signature1", m.protected, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(tbs)
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		m.extra = make([]byte, 64)
+		r.FillBytes(m.extra[:32])
+		s.FillBytes(m.extra[32:])
+	case ed25519.PrivateKey:
+		m.extra = ed25519.Sign(k, tbs)
+	}
+
+	return encodeMessage(m, kid, nil)
+}
+
+// MAC encodes the pack as CBOR and authenticates it with COSE_Mac0 using
+// HMAC 256/256 and a symmetric key.
+func MAC(s senml.SenML, key []byte, kid []byte) ([]byte, error) {
+	payload, err := senml.Encode(s, senml.CBOR, senml.OutputOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return MACPayload(payload, key, kid)
+}
+
+// MACPayload is like MAC for a payload that is already encoded.
+func MACPayload(payload []byte, key []byte, kid []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyType
+	}
+
+	m := message{tag: tagMac0, payload: payload}
+	var err error
+	m.protected, err = protectedHeader(HMAC256)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := toBeSigned("MAC0", m.protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(tbs)
+	m.extra = mac.Sum(nil)
+
+	return encodeMessage(m, kid, nil)
+}
+
+// Verify checks a COSE_Sign1 or COSE_Mac0 message and returns its payload.
+// Signatures are checked with an ECDSA or Ed25519 key, public or private, and
+// MACs with a symmetric key given as a byte slice.
+func Verify(msg []byte, key interface{}) ([]byte, error) {
+	m, err := decodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := m.alg()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case m.tag == tagSign1:
+		tbs, err := toBeSigned("Signature1", m.protected, m.payload)
+		if err != nil {
+			return nil, err
+		}
+		if !verifySignature(alg, key, tbs, m.extra) {
+			return nil, ErrVerify
+		}
+
+	case m.tag == tagMac0:
+		k, ok := key.([]byte)
+		if alg != HMAC256 || !ok {
+			return nil, ErrKeyType
+		}
+		tbs, err := toBeSigned("MAC0", m.protected, m.payload)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(tbs)
+		if !hmac.Equal(mac.Sum(nil), m.extra) {
+			return nil, ErrVerify
+		}
+
+	default:
+		return nil, errors.New("COSE message is not signed")
+	}
+
+	return m.payload, nil
+}
+
+func verifySignature(alg int, key interface{}, tbs []byte, sig []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return verifySignature(alg, &k.PublicKey, tbs, sig)
+	case ed25519.PrivateKey:
+		return verifySignature(alg, k.Public(), tbs, sig)
+
+	case *ecdsa.PublicKey:
+		if alg != ES256 || k.Curve != elliptic.P256() || len(sig) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(tbs)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+
+	case ed25519.PublicKey:
+		return alg == EdDSA && ed25519.Verify(k, tbs, sig)
+	}
+
+	return false
+}
+
+// Decode verifies a COSE_Sign1 or COSE_Mac0 message, or decrypts a
+// COSE_Encrypt0 message, and decodes the CBOR SenML pack it carries.
+func Decode(msg []byte, key interface{}) (senml.SenML, error) {
+	var payload []byte
+	var err error
+
+	if len(msg) > 0 && msg[0] == 0xc0|tagEncrypt0 {
+		k, _ := key.([]byte)
+		payload, err = Decrypt(msg, k)
+	} else {
+		payload, err = Verify(msg, key)
+	}
+	if err != nil {
+		return senml.SenML{}, err
+	}
+	return senml.Decode(payload, senml.CBOR)
+}
+
+// IsCOSE tells if the message starts with a COSE_Sign1, COSE_Mac0 or
+// COSE_Encrypt0 tag
+func IsCOSE(msg []byte) bool {
+	return len(msg) > 0 && bytes.IndexByte([]byte{0xc0 | tagEncrypt0, 0xc0 | tagMac0, 0xc0 | tagSign1}, msg[0]) >= 0
+}
@@ -0,0 +1,149 @@
+package cose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/cisco/senml"
+)
+
+// COSE content encryption algorithm identifiers
+const (
+	A128GCM          = 1
+	A192GCM          = 2
+	A256GCM          = 3
+	AESCCM16_64_128  = 10
+	AESCCM16_64_256  = 11
+	AESCCM64_64_128  = 12
+	AESCCM64_64_256  = 13
+	AESCCM16_128_128 = 30
+	AESCCM16_128_256 = 31
+	AESCCM64_128_128 = 32
+	AESCCM64_128_256 = 33
+)
+
+var ErrDecrypt = errors.New("COSE message does not decrypt")
+
+// aead returns the cipher for an algorithm after checking the key length
+func aead(alg int, key []byte) (cipher.AEAD, error) {
+	var keySize, tagSize, nonceSize int
+
+	switch alg {
+	case A128GCM, A192GCM, A256GCM:
+		keySize = 8 + 8*alg
+	case AESCCM16_64_128, AESCCM64_64_128, AESCCM16_128_128, AESCCM64_128_128:
+		keySize = 16
+	case AESCCM16_64_256, AESCCM64_64_256, AESCCM16_128_256, AESCCM64_128_256:
+		keySize = 32
+	default:
+		return nil, errors.New("COSE encryption algorithm not supported")
+	}
+	if len(key) != keySize {
+		return nil, ErrKeyType
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if alg <= A256GCM {
+		return cipher.NewGCM(block)
+	}
+
+	// the names give the size of the length field, which sets the nonce
+	// size, and of the tag, both in bits
+	tagSize = 8
+	if alg >= AESCCM16_128_128 {
+		tagSize = 16
+	}
+	nonceSize = 13
+	if alg == AESCCM64_64_128 || alg == AESCCM64_64_256 || alg == AESCCM64_128_128 || alg == AESCCM64_128_256 {
+		nonceSize = 7
+	}
+
+	return newCCM(block, tagSize, nonceSize)
+}
+
+// encStructure builds the Enc_structure used as additional data
+func encStructure(protected []byte) ([]byte, error) {
+	return encodeCBOR([]interface{}{"Encrypt0", protected, []byte{}})
+}
+
+// Encrypt encodes the pack as CBOR and encrypts it with COSE_Encrypt0 using
+// one of the AES-GCM or AES-CCM algorithms and a key of the matching size.
+// A random IV goes in the unprotected header.
+func Encrypt(s senml.SenML, alg int, key []byte, kid []byte) ([]byte, error) {
+	payload, err := senml.Encode(s, senml.CBOR, senml.OutputOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return EncryptPayload(payload, alg, key, kid)
+}
+
+// EncryptPayload is like Encrypt for a payload that is already encoded.
+func EncryptPayload(payload []byte, alg int, key []byte, kid []byte) ([]byte, error) {
+	c, err := aead(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, c.NonceSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	m := message{tag: tagEncrypt0}
+	m.protected, err = protectedHeader(alg)
+	if err != nil {
+		return nil, err
+	}
+	aad, err := encStructure(m.protected)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > 0xffff && c.NonceSize() == 13 {
+		return nil, errors.New("payload too long for AES-CCM with a 13 byte nonce")
+	}
+	m.payload = c.Seal(nil, iv, payload, aad)
+
+	return encodeMessage(m, kid, iv)
+}
+
+// Decrypt opens a COSE_Encrypt0 message with a symmetric key and returns the
+// payload.
+func Decrypt(msg []byte, key []byte) ([]byte, error) {
+	m, err := decodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	if m.tag != tagEncrypt0 {
+		return nil, errors.New("COSE message is not encrypted")
+	}
+	alg, err := m.alg()
+	if err != nil {
+		return nil, err
+	}
+	c, err := aead(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := header(m.unprotected, headerIV)
+	iv, ok := v.([]byte)
+	if !ok || len(iv) != c.NonceSize() {
+		return nil, errors.New("COSE message has no IV of the right size")
+	}
+	aad, err := encStructure(m.protected)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := c.Open(nil, iv, m.payload, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return payload, nil
+}
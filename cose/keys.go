@@ -0,0 +1,46 @@
+package cose
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+)
+
+// ReadKey parses a key. PEM blocks may hold a PKCS #8, PKCS #1 or SEC 1
+// private key or a PKIX public key. Anything else is taken as a symmetric key
+// written in hex.
+func ReadKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		key, err := hex.DecodeString(string(bytes.Join(bytes.Fields(data), nil)))
+		if err != nil || len(key) == 0 {
+			return nil, errors.New("key is neither PEM nor hex")
+		}
+		return key, nil
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	return nil, errors.New("unknown PEM block " + block.Type)
+}
+
+// ReadKeyFile reads a key from a file in one of the forms ReadKey accepts.
+func ReadKeyFile(name string) (interface{}, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadKey(data)
+}
@@ -0,0 +1,175 @@
+package senml
+
+import (
+	"container/list"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type DedupOptions struct {
+	// Window is how far back in seconds, from the newest record seen, a
+	// duplicate is looked for. Older records are passed on as is. Zero
+	// means no window.
+	Window float64
+	// MaxEntries bounds the records remembered, forgetting the least
+	// recently seen first. Zero means no bound.
+	MaxEntries int
+	// MatchValue makes records with the same name and time but different
+	// values count as different records.
+	MatchValue bool
+}
+
+// Deduplicator drops records it has already seen, keyed on the resolved name
+// and time, so packs sent again after a lost acknowledgement are not
+// forwarded twice. Only records with absolute times are deduplicated: a
+// relative time only becomes absolute on arrival, so a pack sent again would
+// not match and a later reading could, and those records are passed on. It
+// is safe to use from several goroutines.
+type Deduplicator struct {
+	options DedupOptions
+
+	mu      sync.Mutex
+	seen    map[string]*list.Element
+	recent  *list.List
+	newest  float64
+	oldest  float64
+	dropped uint64
+	passed  uint64
+}
+
+// dedupEntry is what the Deduplicator remembers of a record
+type dedupEntry struct {
+	key  string
+	time float64
+}
+
+func NewDeduplicator(options DedupOptions) *Deduplicator {
+	return &Deduplicator{
+		options: options,
+		seen:    map[string]*list.Element{},
+		recent:  list.New(),
+		newest:  math.Inf(-1),
+		oldest:  math.Inf(1),
+	}
+}
+
+// key builds the key for a resolved record
+func (d *Deduplicator) key(r SenMLRecord) string {
+	var b strings.Builder
+
+	b.WriteString(r.Name)
+	b.WriteByte(0)
+	b.WriteString(strconv.FormatFloat(r.Time, 'g', -1, 64))
+	if d.options.MatchValue {
+		b.WriteByte(0)
+		switch {
+		case r.Value != nil:
+			b.WriteString("v" + strconv.FormatFloat(*r.Value, 'g', -1, 64))
+		case r.StringValue != "":
+			b.WriteString("vs" + r.StringValue)
+		case r.BoolValue != nil:
+			b.WriteString("vb" + strconv.FormatBool(*r.BoolValue))
+		case r.DataValue != "":
+			b.WriteString("vd" + r.DataValue)
+		}
+		if r.Sum != nil {
+			b.WriteString("s" + strconv.FormatFloat(*r.Sum, 'g', -1, 64))
+		}
+	}
+
+	return b.String()
+}
+
+// Apply normalizes the pack and drops the records seen before, so a
+// Deduplicator can be a stage in a Pipeline
+func (d *Deduplicator) Apply(s SenML) (SenML, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		if !r.arrived && d.duplicate(r) {
+			d.dropped += 1
+			return r, false, nil
+		}
+		d.passed += 1
+		return r, true, nil
+	}).Apply(Normalize(s))
+}
+
+// duplicate tells if the record was seen, and remembers it when it was not
+func (d *Deduplicator) duplicate(r SenMLRecord) bool {
+	if d.options.Window > 0 {
+		if r.Time > d.newest {
+			d.newest = r.Time
+			d.expire()
+		}
+		if r.Time < d.newest-d.options.Window {
+			return false
+		}
+	}
+
+	key := d.key(r)
+	if e, ok := d.seen[key]; ok {
+		d.recent.MoveToFront(e)
+		return true
+	}
+
+	d.seen[key] = d.recent.PushFront(dedupEntry{key: key, time: r.Time})
+	if r.Time < d.oldest {
+		d.oldest = r.Time
+	}
+	if d.options.MaxEntries > 0 && d.recent.Len() > d.options.MaxEntries {
+		d.forget(d.recent.Back())
+	}
+
+	return false
+}
+
+// expire forgets the records that fell out of the window. The scan only runs
+// once the oldest record remembered is out of it.
+func (d *Deduplicator) expire() {
+	cutoff := d.newest - d.options.Window
+	if d.oldest >= cutoff {
+		return
+	}
+
+	d.oldest = math.Inf(1)
+	for e := d.recent.Front(); e != nil; {
+		next := e.Next()
+		t := e.Value.(dedupEntry).time
+		if t < cutoff {
+			d.forget(e)
+		} else if t < d.oldest {
+			d.oldest = t
+		}
+		e = next
+	}
+}
+
+func (d *Deduplicator) forget(e *list.Element) {
+	delete(d.seen, e.Value.(dedupEntry).key)
+	d.recent.Remove(e)
+}
+
+// Dropped returns the number of duplicate records dropped
+func (d *Deduplicator) Dropped() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
+
+// Passed returns the number of records passed on
+func (d *Deduplicator) Passed() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.passed
+}
+
+// Len returns the number of records remembered
+func (d *Deduplicator) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.recent.Len()
+}
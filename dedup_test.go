@@ -0,0 +1,106 @@
+package senml_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := senml.NewDeduplicator(senml.DedupOptions{})
+
+	s, err := d.Apply(pipelinePack())
+	if err != nil || len(s.Records) != 4 {
+		t.Fatal("first pack got", s.Records, err)
+	}
+	s, err = d.Apply(pipelinePack())
+	if err != nil || len(s.Records) != 0 {
+		t.Error("pack sent again got", s.Records, err)
+	}
+	if d.Dropped() != 4 || d.Passed() != 4 {
+		t.Error("counters got", d.Dropped(), d.Passed())
+	}
+
+	// a changed value only counts with MatchValue
+	changed := pipelinePack()
+	*changed.Records[0].Value = 21
+	s, _ = d.Apply(changed)
+	if len(s.Records) != 0 {
+		t.Error("changed value without MatchValue got", names(s))
+	}
+	d = senml.NewDeduplicator(senml.DedupOptions{MatchValue: true})
+	d.Apply(pipelinePack())
+	s, _ = d.Apply(changed)
+	if names(s) != "room1/temp" {
+		t.Error("changed value with MatchValue got", names(s))
+	}
+}
+
+func TestDeduplicatorBounds(t *testing.T) {
+	d := senml.NewDeduplicator(senml.DedupOptions{MaxEntries: 2})
+	d.Apply(pipelinePack())
+	if d.Len() != 2 {
+		t.Error("MaxEntries kept", d.Len())
+	}
+	s, _ := d.Apply(pipelinePack())
+	if len(s.Records) != 4 {
+		t.Error("forgotten records got", names(s))
+	}
+
+	d = senml.NewDeduplicator(senml.DedupOptions{Window: 15})
+	d.Apply(pipelinePack())
+	if d.Len() != 2 {
+		t.Error("Window kept", d.Len())
+	}
+	s, _ = d.Apply(pipelinePack())
+	if names(s) != "room1/temp,room1/hum" {
+		t.Error("records older than the window got", names(s))
+	}
+}
+
+func TestDeduplicatorConcurrent(t *testing.T) {
+	d := senml.NewDeduplicator(senml.DedupOptions{MaxEntries: 100})
+	p := senml.Pipeline{d}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Apply(pipelinePack())
+		}()
+	}
+	wg.Wait()
+	if d.Passed() != 4 || d.Dropped() != 28 {
+		t.Error("concurrent counters got", d.Passed(), d.Dropped())
+	}
+}
+
+func TestDeduplicatorRelativeTimes(t *testing.T) {
+	d := senml.NewDeduplicator(senml.DedupOptions{})
+	v := 1.0
+	relative := senml.SenML{Records: []senml.SenMLRecord{{Name: "a", Time: -5, Value: &v}}}
+
+	for i := 0; i < 2; i++ {
+		s, err := d.Apply(relative)
+		if err != nil || len(s.Records) != 1 {
+			t.Error("relative time got", s.Records, err)
+		}
+	}
+	if d.Len() != 0 {
+		t.Error("relative time remembered")
+	}
+
+	// a Pipeline makes the times absolute before the stage sees them
+	p := senml.Pipeline{d}
+	for i := 0; i < 2; i++ {
+		s, err := p.Apply(relative)
+		if err != nil || len(s.Records) != 1 {
+			t.Error("relative time in a pipeline got", s.Records, err)
+		}
+	}
+	if d.Len() != 0 || d.Dropped() != 0 {
+		t.Error("relative time in a pipeline dropped", d.Dropped())
+	}
+}
@@ -0,0 +1,731 @@
+package senml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// diagWriter writes items in the extended diagnostic notation (EDN) of RFC
+// 8949 section 8 and RFC 8610 appendix G. When pretty is set the elements of
+// the outermost array or map go on lines of their own, and CBOR labels found
+// in names are annotated with a comment giving the field name.
+type diagWriter struct {
+	buf    *bytes.Buffer
+	pretty bool
+	cbor   bool
+	names  map[int]string
+}
+
+func (w diagWriter) write(it item, depth int) {
+	buf := w.buf
+
+	switch it.kind {
+	case uintItem, negItem:
+		if it.kind == uintItem {
+			buf.WriteString(strconv.FormatUint(it.u, 10))
+		} else if it.u == math.MaxUint64 {
+			buf.WriteString("-18446744073709551616")
+		} else {
+			buf.WriteString("-")
+			buf.WriteString(strconv.FormatUint(it.u+1, 10))
+		}
+		if w.cbor && it.size > argSize(it.u) {
+			// note integers sent in more bytes than needed
+			buf.WriteString(sizeIndicators[it.size])
+		}
+
+	case floatItem:
+		writeDiagFloat(buf, it.f, it.size)
+
+	case bytesItem:
+		buf.WriteString("h'")
+		buf.WriteString(hex.EncodeToString(it.b))
+		buf.WriteString("'")
+
+	case textItem:
+		writeDiagString(buf, it.b)
+
+	case arrayItem, mapItem:
+		open, close := "[", "]"
+		step := 1
+		if it.kind == mapItem {
+			open, close = "{", "}"
+			step = 2
+		}
+		buf.WriteString(open)
+		if it.indefinite {
+			buf.WriteString("_ ")
+		}
+		split := w.pretty && depth == 0 && len(it.items) > 0
+		for i := 0; i < len(it.items); i += step {
+			if i > 0 {
+				buf.WriteString(",")
+				if !split {
+					buf.WriteString(" ")
+				}
+			}
+			if split {
+				buf.WriteString("\n  ")
+			}
+			if it.kind == mapItem {
+				w.key(it.items[i], depth+1)
+				buf.WriteString(": ")
+				w.write(it.items[i+1], depth+1)
+			} else {
+				w.write(it.items[i], depth+1)
+			}
+		}
+		if split {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(close)
+
+	case tagItem:
+		buf.WriteString(strconv.FormatUint(it.u, 10))
+		buf.WriteString("(")
+		w.write(it.items[0], depth+1)
+		buf.WriteString(")")
+
+	case simpleItem:
+		switch it.u {
+		case simpleFalse:
+			buf.WriteString("false")
+		case simpleTrue:
+			buf.WriteString("true")
+		case simpleNull:
+			buf.WriteString("null")
+		case 23:
+			buf.WriteString("undefined")
+		default:
+			buf.WriteString("simple(")
+			buf.WriteString(strconv.FormatUint(it.u, 10))
+			buf.WriteString(")")
+		}
+
+	case extItem:
+		// MessagePack extensions have no EDN form so borrow the tag syntax
+		buf.WriteString("ext")
+		buf.WriteString(strconv.Itoa(int(int8(it.u))))
+		buf.WriteString("(h'")
+		buf.WriteString(hex.EncodeToString(it.b))
+		buf.WriteString("')")
+	}
+}
+
+func (w diagWriter) key(k item, depth int) {
+	if label, ok := k.int(); ok && w.pretty && w.names != nil {
+		if name, known := w.names[int(label)]; known {
+			w.buf.WriteString("/")
+			w.buf.WriteString(name)
+			w.buf.WriteString("/ ")
+		}
+	}
+	w.write(k, depth)
+}
+
+// writeDiagFloat writes a float, adding an encoding indicator when it was
+// not sent as a double
+func writeDiagFloat(buf *bytes.Buffer, f float64, size int) {
+	switch {
+	case math.IsNaN(f):
+		buf.WriteString("NaN")
+	case math.IsInf(f, 1):
+		buf.WriteString("Infinity")
+	case math.IsInf(f, -1):
+		buf.WriteString("-Infinity")
+	default:
+		bits := 64
+		if size == 4 {
+			bits = 32
+		}
+		format := byte('f')
+		if a := math.Abs(f); a != 0 && (a < 1e-6 || a >= 1e21) {
+			format = 'g'
+		}
+		s := strconv.FormatFloat(f, format, -1, bits)
+		if !bytes.ContainsAny([]byte(s), ".e") {
+			s += ".0"
+		}
+		buf.WriteString(s)
+	}
+
+	if size == 2 || size == 4 {
+		buf.WriteString(sizeIndicators[size])
+	}
+}
+
+// sizeIndicators gives the EDN encoding indicator for the number of bytes a
+// number was sent in
+var sizeIndicators = map[int]string{1: "_0", 2: "_1", 4: "_2", 8: "_3"}
+
+func writeDiagString(buf *bytes.Buffer, b []byte) {
+	const hexDigits = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString("\\n")
+		case r == '\r':
+			buf.WriteString("\\r")
+		case r == '\t':
+			buf.WriteString("\\t")
+		case r < 0x20 || r == 0x7f || (r == utf8.RuneError && size == 1):
+			c := b[0]
+			buf.WriteString("\\u00")
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		default:
+			buf.Write(b[:size])
+		}
+		b = b[size:]
+	}
+	buf.WriteByte('"')
+}
+
+// cborDiag converts a CBOR message to diagnostic notation
+func cborDiag(data []byte, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := diagWriter{buf: &buf, pretty: pretty, cbor: true, names: labels}
+	for len(data) > 0 {
+		it, n, err := readCBOR(data)
+		if err != nil {
+			return nil, err
+		}
+		w.write(it, 0)
+		buf.WriteString("\n")
+		data = data[n:]
+	}
+
+	return buf.Bytes(), nil
+}
+
+// msgpackDiag converts a MessagePack message to diagnostic notation
+func msgpackDiag(data []byte, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := diagWriter{buf: &buf, pretty: pretty}
+	for len(data) > 0 {
+		it, n, err := readMsgpack(data)
+		if err != nil {
+			return nil, err
+		}
+		w.write(it, 0)
+		buf.WriteString("\n")
+		data = data[n:]
+	}
+
+	return buf.Bytes(), nil
+}
+
+// diagParser reads diagnostic notation back into items
+type diagParser struct {
+	text []byte
+	pos  int
+}
+
+// parseDiag converts diagnostic notation to CBOR. Several items in a row
+// become a CBOR sequence.
+func parseDiag(text []byte) ([]byte, error) {
+	var data []byte
+
+	p := diagParser{text: text}
+	p.space()
+	for p.pos < len(p.text) {
+		it, err := p.item(0)
+		if err != nil {
+			return nil, fmt.Errorf("diagnostic notation at offset %d: %v", p.pos, err)
+		}
+		data = appendCBOR(data, it)
+		p.space()
+	}
+	if len(data) == 0 {
+		return nil, errors.New("no data in diagnostic notation")
+	}
+
+	return data, nil
+}
+
+// space skips white space and comments, both /.../ and # to end of line
+func (p *diagParser) space() {
+	for p.pos < len(p.text) {
+		switch c := p.text[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.pos += 1
+		case c == '/':
+			end := bytes.IndexByte(p.text[p.pos+1:], '/')
+			if end < 0 {
+				p.pos = len(p.text)
+			} else {
+				p.pos += end + 2
+			}
+		case c == '#':
+			end := bytes.IndexByte(p.text[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.text)
+			} else {
+				p.pos += end + 1
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *diagParser) peek() byte {
+	if p.pos < len(p.text) {
+		return p.text[p.pos]
+	}
+	return 0
+}
+
+func (p *diagParser) expect(c byte) error {
+	p.space()
+	if p.peek() != c {
+		return fmt.Errorf("expected %q", c)
+	}
+	p.pos += 1
+	return nil
+}
+
+func (p *diagParser) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(p.text[p.pos:], []byte(prefix))
+}
+
+func (p *diagParser) item(depth int) (item, error) {
+	var it item
+
+	if depth > maxItemDepth {
+		return it, errDeepItem
+	}
+	p.space()
+
+	c := p.peek()
+	switch {
+	case c == '[' || c == '{':
+		return p.container(depth)
+
+	case c == '(':
+		return p.chunks(depth)
+
+	case c == '"':
+		return p.text1()
+
+	case c == '\'':
+		b, err := p.quoted('\'')
+		return item{kind: bytesItem, b: b}, err
+
+	case p.hasPrefix("h'"):
+		p.pos += 1
+		b, err := p.quoted('\'')
+		if err != nil {
+			return it, err
+		}
+		b, err = hex.DecodeString(string(stripSpace(b)))
+		return item{kind: bytesItem, b: b}, err
+
+	case p.hasPrefix("b64'"):
+		p.pos += 3
+		b, err := p.quoted('\'')
+		if err != nil {
+			return it, err
+		}
+		b, err = decodeBase64(string(stripSpace(b)))
+		return item{kind: bytesItem, b: b}, err
+
+	case c == '-' || c == '+' || (c >= '0' && c <= '9') || p.hasPrefix("NaN") || p.hasPrefix("Infinity"):
+		return p.number(depth)
+	}
+
+	for _, word := range []struct {
+		name  string
+		value uint64
+	}{{"false", simpleFalse}, {"true", simpleTrue}, {"null", simpleNull}, {"undefined", 23}} {
+		if p.hasPrefix(word.name) {
+			p.pos += len(word.name)
+			return item{kind: simpleItem, u: word.value}, nil
+		}
+	}
+	if p.hasPrefix("simple(") {
+		p.pos += len("simple(")
+		n, err := p.number(depth)
+		if err != nil {
+			return it, err
+		}
+		if n.kind != uintItem || n.u > 255 {
+			return it, errors.New("bad simple value")
+		}
+		return item{kind: simpleItem, u: n.u}, p.expect(')')
+	}
+
+	return it, errors.New("unexpected character")
+}
+
+// container reads an array or map
+func (p *diagParser) container(depth int) (item, error) {
+	it := item{kind: arrayItem}
+	close := byte(']')
+	if p.peek() == '{' {
+		it.kind = mapItem
+		close = '}'
+	}
+	p.pos += 1
+
+	p.space()
+	if p.peek() == '_' {
+		it.indefinite = true
+		p.pos += 1
+	}
+	for {
+		p.space()
+		if p.peek() == close {
+			p.pos += 1
+			return it, nil
+		}
+		if len(it.items) > 0 {
+			err := p.expect(',')
+			if err != nil {
+				return it, err
+			}
+		}
+		sub, err := p.item(depth + 1)
+		if err != nil {
+			return it, err
+		}
+		it.items = append(it.items, sub)
+		if it.kind == mapItem {
+			err = p.expect(':')
+			if err != nil {
+				return it, err
+			}
+			sub, err = p.item(depth + 1)
+			if err != nil {
+				return it, err
+			}
+			it.items = append(it.items, sub)
+		}
+	}
+}
+
+// chunks reads an indefinite length string written as (_ "a", "b")
+func (p *diagParser) chunks(depth int) (item, error) {
+	p.pos += 1
+	err := p.expect('_')
+	if err != nil {
+		return item{}, err
+	}
+
+	it := item{indefinite: true, b: []byte{}}
+	for first := true; ; first = false {
+		p.space()
+		if p.peek() == ')' {
+			p.pos += 1
+			break
+		}
+		if !first {
+			err = p.expect(',')
+			if err != nil {
+				return it, err
+			}
+		}
+		sub, err := p.item(depth + 1)
+		if err != nil {
+			return it, err
+		}
+		if (sub.kind != bytesItem && sub.kind != textItem) || (it.kind != 0 && sub.kind != it.kind) {
+			return it, errors.New("bad chunk in string")
+		}
+		it.kind = sub.kind
+		it.b = append(it.b, sub.b...)
+	}
+	if it.kind == 0 {
+		it.kind = bytesItem
+	}
+
+	return it, nil
+}
+
+// text1 reads a JSON style double quoted text string
+func (p *diagParser) text1() (item, error) {
+	start := p.pos
+	p.pos += 1
+	for p.pos < len(p.text) && p.text[p.pos] != '"' {
+		if p.text[p.pos] == '\\' {
+			p.pos += 1
+		}
+		p.pos += 1
+	}
+	if p.pos >= len(p.text) {
+		return item{}, errors.New("unterminated string")
+	}
+	p.pos += 1
+
+	var s string
+	err := json.Unmarshal(p.text[start:p.pos], &s)
+
+	return item{kind: textItem, b: []byte(s)}, err
+}
+
+// quoted reads the text between single quotes, undoing \' and \\ escapes
+func (p *diagParser) quoted(quote byte) ([]byte, error) {
+	var b []byte
+
+	p.pos += 1
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		p.pos += 1
+		switch {
+		case c == quote:
+			return b, nil
+		case c == '\\' && p.pos < len(p.text):
+			b = append(b, p.text[p.pos])
+			p.pos += 1
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return nil, errors.New("unterminated string")
+}
+
+func stripSpace(b []byte) []byte {
+	return bytes.Join(bytes.Fields(b), nil)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// number reads an integer, float or tag
+func (p *diagParser) number(depth int) (item, error) {
+	var it item
+
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '.' || c == '-' || c == '+') {
+			break
+		}
+		// a sign is only part of the number at the start or after an exponent
+		if (c == '-' || c == '+') && p.pos > start && !strings.ContainsAny(string(p.text[p.pos-1]), "eE") {
+			break
+		}
+		p.pos += 1
+	}
+	token := string(p.text[start:p.pos])
+
+	size := 0
+	if p.peek() == '_' && p.pos+1 < len(p.text) {
+		switch p.text[p.pos+1] {
+		case '0':
+			size = 1
+		case '1':
+			size = 2
+		case '2':
+			size = 4
+		case '3':
+			size = 8
+		default:
+			return it, errors.New("bad encoding indicator")
+		}
+		p.pos += 2
+	}
+
+	neg := strings.HasPrefix(token, "-")
+	digits := strings.TrimLeft(token, "+-")
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		base = 16
+	case strings.HasPrefix(digits, "0o"):
+		base = 8
+	case strings.HasPrefix(digits, "0b"):
+		base = 2
+	}
+
+	isFloat := base == 10 && (strings.ContainsAny(digits, ".eE") || digits == "NaN" || digits == "Infinity")
+	if isFloat {
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return it, err
+		}
+		if size == 0 {
+			size = 8
+		}
+		if size == 1 {
+			return it, errors.New("floats can not be sent in one byte")
+		}
+		return item{kind: floatItem, f: f, size: size}, nil
+	}
+
+	if base != 10 {
+		digits = digits[2:]
+	}
+	if neg && base == 10 && digits == "18446744073709551616" {
+		return item{kind: negItem, u: math.MaxUint64, size: size}, nil
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return it, err
+	}
+	it = item{kind: uintItem, u: u, size: size}
+	if neg && u > 0 {
+		it = item{kind: negItem, u: u - 1, size: size}
+	}
+	if size > 0 && size < argSize(it.u) {
+		return it, errors.New("integer too large for encoding indicator")
+	}
+
+	// an unsigned integer followed by parentheses is a tag
+	if it.kind == uintItem && p.peek() == '(' {
+		p.pos += 1
+		sub, err := p.item(depth + 1)
+		if err != nil {
+			return it, err
+		}
+		return item{kind: tagItem, u: u, items: []item{sub}}, p.expect(')')
+	}
+
+	return it, nil
+}
+
+// cborHex writes CBOR as hex. When pretty is set each item goes on a line of
+// its own, indented to show nesting, with a comment describing it.
+func cborHex(data []byte, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if !pretty {
+		buf.WriteString(hex.EncodeToString(data))
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+
+	for len(data) > 0 {
+		it, n, err := readCBOR(data)
+		if err != nil {
+			return nil, err
+		}
+		hexItem(&buf, it, 0, "")
+		data = data[n:]
+	}
+
+	return buf.Bytes(), nil
+}
+
+// hexLine writes one line of an annotated hex dump
+func hexLine(buf *bytes.Buffer, depth int, data []byte, comment string) {
+	const column = 32
+
+	start := buf.Len()
+	for i := 0; i < depth; i++ {
+		buf.WriteString("   ")
+	}
+	buf.WriteString(hex.EncodeToString(data))
+	if gap := column - (buf.Len() - start); gap > 0 {
+		pad(buf, gap)
+	} else {
+		buf.WriteString(" ")
+	}
+	buf.WriteString("# ")
+	buf.WriteString(comment)
+	buf.WriteString("\n")
+}
+
+func hexItem(buf *bytes.Buffer, it item, depth int, note string) {
+	var desc bytes.Buffer
+
+	switch it.kind {
+	case bytesItem, textItem:
+		major, name := byte(2), "bytes"
+		if it.kind == textItem {
+			major, name = 3, "text"
+		}
+		if it.indefinite {
+			hexLine(buf, depth, []byte{major<<5 | 31}, name+"(*)")
+			depth += 1
+		}
+		head := appendCBORHead(nil, major, uint64(len(it.b)), 0)
+		hexLine(buf, depth, head, name+"("+strconv.Itoa(len(it.b))+")"+note)
+		if len(it.b) > 0 {
+			desc.Reset()
+			if it.kind == textItem {
+				writeDiagString(&desc, it.b)
+			}
+			hexLine(buf, depth+1, it.b, desc.String())
+		}
+		if it.indefinite {
+			hexLine(buf, depth-1, []byte{0xff}, "break")
+		}
+
+	case arrayItem, mapItem:
+		major, name, count := byte(4), "array", len(it.items)
+		if it.kind == mapItem {
+			major, name, count = 5, "map", count/2
+		}
+		if it.indefinite {
+			hexLine(buf, depth, []byte{major<<5 | 31}, name+"(*)"+note)
+		} else {
+			head := appendCBORHead(nil, major, uint64(count), 0)
+			hexLine(buf, depth, head, name+"("+strconv.Itoa(count)+")"+note)
+		}
+		for i, sub := range it.items {
+			subNote := ""
+			if label, ok := sub.int(); ok && it.kind == mapItem && i%2 == 0 {
+				if field, known := labels[int(label)]; known {
+					subNote = " " + field
+				}
+			}
+			hexItem(buf, sub, depth+1, subNote)
+		}
+		if it.indefinite {
+			hexLine(buf, depth, []byte{0xff}, "break")
+		}
+
+	case tagItem:
+		head := appendCBORHead(nil, 6, it.u, 0)
+		hexLine(buf, depth, head, "tag("+strconv.FormatUint(it.u, 10)+")"+note)
+		hexItem(buf, it.items[0], depth+1, "")
+
+	default:
+		w := diagWriter{buf: &desc, cbor: true}
+		w.write(it, 0)
+		hexLine(buf, depth, appendCBOR(nil, it), desc.String()+note)
+	}
+}
+
+// parseHex reads CBOR written as hex, ignoring white space and # comments
+func parseHex(text []byte) ([]byte, error) {
+	var digits []byte
+
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		if i := bytes.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		digits = append(digits, stripSpace(line)...)
+	}
+
+	data := make([]byte, hex.DecodedLen(len(digits)))
+	_, err := hex.Decode(data, digits)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
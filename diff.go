@@ -0,0 +1,147 @@
+package senml
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordChange is a record found in both packs with different fields
+type RecordChange struct {
+	Old SenMLRecord
+	New SenMLRecord
+	// Fields names the fields that differ
+	Fields []string
+	// Delta is New.Value - Old.Value when both records have a value
+	Delta *float64
+}
+
+// DiffReport lists how the resolved records of two packs differ. Records
+// are matched on name and time.
+type DiffReport struct {
+	Added   []SenMLRecord
+	Removed []SenMLRecord
+	Changed []RecordChange
+}
+
+// Empty tells if the packs had the same records
+func (d DiffReport) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String lists the differences one per line, marked + for added, - for
+// removed and ~ for changed records
+func (d DiffReport) String() string {
+	var buf bytes.Buffer
+
+	for _, r := range d.Removed {
+		fmt.Fprintf(&buf, "- %s\n", describeRecord(r))
+	}
+	for _, r := range d.Added {
+		fmt.Fprintf(&buf, "+ %s\n", describeRecord(r))
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&buf, "~ %s t=%s", c.Old.Name, formatFloat(c.Old.Time))
+		for _, field := range c.Fields {
+			fmt.Fprintf(&buf, " %s: %s -> %s", field, diffFields[field](c.Old), diffFields[field](c.New))
+			if field == "v" && c.Delta != nil {
+				fmt.Fprintf(&buf, " (%+g)", *c.Delta)
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// diffFields lists the fields compared, other than the name and time, with
+// their value as text or "" when missing
+var diffFields = map[string]func(r SenMLRecord) string{
+	"u":  func(r SenMLRecord) string { return r.Unit },
+	"v":  func(r SenMLRecord) string { return formatPointer(r.Value) },
+	"vs": func(r SenMLRecord) string { return strconv.Quote(r.StringValue) },
+	"vb": func(r SenMLRecord) string {
+		if r.BoolValue == nil {
+			return ""
+		}
+		return strconv.FormatBool(*r.BoolValue)
+	},
+	"vd": func(r SenMLRecord) string { return r.DataValue },
+	"s":  func(r SenMLRecord) string { return formatPointer(r.Sum) },
+	"ut": func(r SenMLRecord) string { return formatNumber(r.UpdateTime) },
+	"l":  func(r SenMLRecord) string { return r.Link },
+}
+
+// diffOrder is the order fields are compared and reported in
+var diffOrder = []string{"u", "v", "vs", "vb", "vd", "s", "ut", "l"}
+
+func describeRecord(r SenMLRecord) string {
+	parts := []string{r.Name, "t=" + formatFloat(r.Time)}
+	for _, field := range diffOrder {
+		value := diffFields[field](r)
+		if value != "" && value != `""` {
+			parts = append(parts, field+"="+value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Diff compares the resolved records of two packs. Relative times in both
+// resolve against the same moment so they match each other.
+func Diff(a SenML, b SenML) DiffReport {
+	var d DiffReport
+
+	now := time.Now()
+	oldRecords := normalizeAt(a, now, 5).Records
+	newRecords := normalizeAt(b, now, 5).Records
+
+	// records with the same name and time pair up in order
+	key := func(r SenMLRecord) string {
+		return r.Name + "\x00" + formatFloat(r.Time)
+	}
+	pending := map[string][]int{}
+	for i, r := range newRecords {
+		pending[key(r)] = append(pending[key(r)], i)
+	}
+	matched := make([]bool, len(newRecords))
+
+	for _, old := range oldRecords {
+		k := key(old)
+		if len(pending[k]) == 0 {
+			d.Removed = append(d.Removed, old)
+			continue
+		}
+		i := pending[k][0]
+		pending[k] = pending[k][1:]
+		matched[i] = true
+
+		change := RecordChange{Old: old, New: newRecords[i]}
+		for _, field := range diffOrder {
+			if diffFields[field](old) != diffFields[field](change.New) {
+				change.Fields = append(change.Fields, field)
+			}
+		}
+		if len(change.Fields) == 0 {
+			continue
+		}
+		if old.Value != nil && change.New.Value != nil {
+			delta := *change.New.Value - *old.Value
+			change.Delta = &delta
+		}
+		d.Changed = append(d.Changed, change)
+	}
+
+	for i, r := range newRecords {
+		if !matched[i] {
+			d.Added = append(d.Added, r)
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,78 @@
+package senml_test
+
+import (
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestDiff(t *testing.T) {
+	v1 := 20.0
+	v2 := 21.5
+	v3 := 40.0
+	yes := true
+	a := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev/", BaseTime: 1000, Name: "temp", Unit: "Cel", Value: &v1},
+		{Name: "hum", Unit: "%RH", Value: &v3},
+		{Name: "gone", StringValue: "x"},
+	}}
+	b := senml.SenML{Records: []senml.SenMLRecord{
+		{Name: "dev/temp", Unit: "Cel", Value: &v2, Time: 1000},
+		{Name: "dev/hum", Unit: "%RH", Value: &v3, Time: 1000},
+		{Name: "dev/new", BoolValue: &yes, Time: 1000},
+	}}
+
+	d := senml.Diff(a, b)
+	if d.Empty() {
+		t.Fatal("Diff found no difference")
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "dev/gone" {
+		t.Error("Diff removed got", d.Removed)
+	}
+	if len(d.Added) != 1 || d.Added[0].Name != "dev/new" {
+		t.Error("Diff added got", d.Added)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Delta == nil || *d.Changed[0].Delta != 1.5 {
+		t.Fatal("Diff changed got", d.Changed)
+	}
+	if len(d.Changed[0].Fields) != 1 || d.Changed[0].Fields[0] != "v" {
+		t.Error("Diff changed fields got", d.Changed[0].Fields)
+	}
+
+	want := "- dev/gone t=1000 vs=\"x\"\n" +
+		"+ dev/new t=1000 vb=true\n" +
+		"~ dev/temp t=1000 v: 20 -> 21.5 (+1.5)\n"
+	if got := d.String(); got != want {
+		t.Errorf("Diff String got\n%s\nwant\n%s", got, want)
+	}
+
+	if d := senml.Diff(a, a); !d.Empty() || d.String() != "" {
+		t.Error("Diff of a pack with itself got", d)
+	}
+
+	// relative times resolve against the same moment in both packs
+	rel := senml.SenML{Records: []senml.SenMLRecord{{Name: "x", Value: &v1, Time: -5}}}
+	if d := senml.Diff(rel, rel); !d.Empty() {
+		t.Error("Diff of relative times got", d)
+	}
+}
+
+func TestFormatForFile(t *testing.T) {
+	tests := map[string]senml.Format{
+		"a.json":     senml.JSON,
+		"dir/b.CBOR": senml.CBOR,
+		"c.xml":      senml.XML,
+		"d.msgpack":  senml.MPACK,
+		"e.jsonl":    senml.JSONLINE,
+		"f.diag":     senml.CBORDIAG,
+		"g.hex":      senml.CBORHEX,
+	}
+	for name, want := range tests {
+		if got, ok := senml.FormatForFile(name); !ok || got != want {
+			t.Error("FormatForFile", name, "got", got, ok)
+		}
+	}
+	if _, ok := senml.FormatForFile("data.txt"); ok {
+		t.Error("FormatForFile guessed a format for data.txt")
+	}
+}
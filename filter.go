@@ -0,0 +1,411 @@
+package senml
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled filter expression over SenML records
+type Filter struct {
+	expr string
+	eval func(r *SenMLRecord) filterValue
+}
+
+type filterKind int
+
+const (
+	missingKind filterKind = iota
+	numberKind
+	stringKind
+	boolKind
+)
+
+func (k filterKind) String() string {
+	return [...]string{"missing", "number", "string", "bool"}[k]
+}
+
+// filterValue is the value of a field or literal while evaluating a filter
+type filterValue struct {
+	kind filterKind
+	num  float64
+	str  string
+	b    bool
+}
+
+// truth gives the value of an operand used on its own: a bool is itself,
+// other values are true when the field is present
+func (v filterValue) truth() bool {
+	if v.kind == boolKind {
+		return v.b
+	}
+	return v.kind != missingKind
+}
+
+// filterFields lists the fields a filter can use, with their kind
+var filterFields = map[string]struct {
+	kind  filterKind
+	value func(r *SenMLRecord) filterValue
+}{
+	"bn":   {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.BaseName) }},
+	"bt":   {numberKind, func(r *SenMLRecord) filterValue { return numberField(r.BaseTime) }},
+	"bu":   {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.BaseUnit) }},
+	"bver": {numberKind, func(r *SenMLRecord) filterValue { return numberField(float64(r.BaseVersion)) }},
+	"n":    {stringKind, func(r *SenMLRecord) filterValue { return filterValue{kind: stringKind, str: r.Name} }},
+	"u":    {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.Unit) }},
+	"t":    {numberKind, func(r *SenMLRecord) filterValue { return filterValue{kind: numberKind, num: r.Time} }},
+	"ut":   {numberKind, func(r *SenMLRecord) filterValue { return numberField(r.UpdateTime) }},
+	"v":    {numberKind, func(r *SenMLRecord) filterValue { return pointerField(r.Value) }},
+	"vs":   {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.StringValue) }},
+	"vd":   {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.DataValue) }},
+	"s":    {numberKind, func(r *SenMLRecord) filterValue { return pointerField(r.Sum) }},
+	"l":    {stringKind, func(r *SenMLRecord) filterValue { return stringField(r.Link) }},
+	"vb": {boolKind, func(r *SenMLRecord) filterValue {
+		if r.BoolValue == nil {
+			return filterValue{}
+		}
+		return filterValue{kind: boolKind, b: *r.BoolValue}
+	}},
+}
+
+func stringField(s string) filterValue {
+	if s == "" {
+		return filterValue{}
+	}
+	return filterValue{kind: stringKind, str: s}
+}
+
+func numberField(f float64) filterValue {
+	if f == 0 {
+		return filterValue{}
+	}
+	return filterValue{kind: numberKind, num: f}
+}
+
+func pointerField(f *float64) filterValue {
+	if f == nil {
+		return filterValue{}
+	}
+	return filterValue{kind: numberKind, num: *f}
+}
+
+// CompileFilter compiles a filter expression such as
+//
+//	n =~ "temp.*" && v > 30 && u == "Cel"
+//
+// Operands are the SenML field names, numbers, "strings", true and false.
+// The operators are == != < <= > >= and =~ !~ for regular expressions, with
+// && || ! and parentheses to combine them. A field on its own is true when
+// the record has it, or for vb when it is true. Comparisons with a field the
+// record lacks are false.
+func CompileFilter(expr string) (*Filter, error) {
+	p := filterParser{text: expr}
+	err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %q", p.tok)
+	}
+	if n.kind != boolKind && !n.field {
+		return nil, fmt.Errorf("filter %q is not a condition", expr)
+	}
+
+	return &Filter{expr: expr, eval: n.eval}, nil
+}
+
+// Match tells if the record passes the filter
+func (f *Filter) Match(r SenMLRecord) bool {
+	return f.eval(&r).truth()
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Apply keeps the records that pass the filter, so a Filter can be a stage in
+// a Pipeline
+func (f *Filter) Apply(s SenML) (SenML, error) {
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		return r, f.Match(r), nil
+	}).Apply(s)
+}
+
+// filterNode is a compiled part of an expression. Literals carry their value
+// so comparisons can check types and compile regular expressions up front.
+type filterNode struct {
+	kind    filterKind
+	field   bool
+	literal *filterValue
+	eval    func(r *SenMLRecord) filterValue
+}
+
+type filterParser struct {
+	text string
+	pos  int
+	tok  string
+	at   int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter at offset %d: %s", p.at, fmt.Sprintf(format, args...))
+}
+
+// next moves to the next token. Tokens are operators, names, numbers and
+// quoted strings; the empty token marks the end.
+func (p *filterParser) next() error {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos += 1
+	}
+	p.at = p.pos
+	if p.pos >= len(p.text) {
+		p.tok = ""
+		return nil
+	}
+
+	rest := p.text[p.pos:]
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"} {
+		if strings.HasPrefix(rest, op) {
+			p.tok = op
+			p.pos += len(op)
+			return nil
+		}
+	}
+
+	c := rest[0]
+	end := 1
+	switch {
+	case c == '"':
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end += 1
+			}
+			end += 1
+		}
+		if end >= len(rest) {
+			return p.errorf("unterminated string")
+		}
+		end += 1
+
+	case c == '-' || c == '.' || c >= '0' && c <= '9':
+		for end < len(rest) && strings.IndexByte("0123456789.eE+-", rest[end]) >= 0 {
+			if (rest[end] == '+' || rest[end] == '-') && !strings.ContainsRune("eE", rune(rest[end-1])) {
+				break
+			}
+			end += 1
+		}
+
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for end < len(rest) && (rest[end] == '_' || rest[end] >= 'a' && rest[end] <= 'z' ||
+			rest[end] >= 'A' && rest[end] <= 'Z' || rest[end] >= '0' && rest[end] <= '9') {
+			end += 1
+		}
+
+	default:
+		return p.errorf("unexpected %q", string(c))
+	}
+
+	p.tok = rest[:end]
+	p.pos += end
+	return nil
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	for err == nil && p.tok == "||" {
+		err = p.next()
+		if err != nil {
+			break
+		}
+		var right filterNode
+		right, err = p.and()
+		l, r := left.eval, right.eval
+		left = filterNode{kind: boolKind, eval: func(rec *SenMLRecord) filterValue {
+			return filterValue{kind: boolKind, b: l(rec).truth() || r(rec).truth()}
+		}}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.not()
+	for err == nil && p.tok == "&&" {
+		err = p.next()
+		if err != nil {
+			break
+		}
+		var right filterNode
+		right, err = p.not()
+		l, r := left.eval, right.eval
+		left = filterNode{kind: boolKind, eval: func(rec *SenMLRecord) filterValue {
+			return filterValue{kind: boolKind, b: l(rec).truth() && r(rec).truth()}
+		}}
+	}
+	return left, err
+}
+
+func (p *filterParser) not() (filterNode, error) {
+	if p.tok != "!" {
+		return p.compare()
+	}
+	err := p.next()
+	if err != nil {
+		return filterNode{}, err
+	}
+	n, err := p.not()
+	e := n.eval
+	return filterNode{kind: boolKind, eval: func(rec *SenMLRecord) filterValue {
+		return filterValue{kind: boolKind, b: !e(rec).truth()}
+	}}, err
+}
+
+func (p *filterParser) compare() (filterNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return left, err
+	}
+
+	op := p.tok
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return left, nil
+	}
+	at := p.at
+	err = p.next()
+	if err != nil {
+		return left, err
+	}
+	right, err := p.operand()
+	if err != nil {
+		return right, err
+	}
+
+	l, r := left.eval, right.eval
+	node := filterNode{kind: boolKind}
+
+	if op == "=~" || op == "!~" {
+		if right.literal == nil || right.kind != stringKind {
+			return node, fmt.Errorf("filter at offset %d: %s needs a string pattern", at, op)
+		}
+		if left.kind != stringKind {
+			return node, fmt.Errorf("filter at offset %d: %s needs a string field", at, op)
+		}
+		re, err := regexp.Compile(right.literal.str)
+		if err != nil {
+			return node, err
+		}
+		want := op == "=~"
+		node.eval = func(rec *SenMLRecord) filterValue {
+			v := l(rec)
+			return filterValue{kind: boolKind, b: v.kind == stringKind && re.MatchString(v.str) == want}
+		}
+		return node, nil
+	}
+
+	if left.kind != right.kind {
+		return node, fmt.Errorf("filter at offset %d: can not compare %s with %s", at, left.kind, right.kind)
+	}
+	if left.kind == boolKind && op != "==" && op != "!=" {
+		return node, fmt.Errorf("filter at offset %d: %s does not apply to bools", at, op)
+	}
+	node.eval = func(rec *SenMLRecord) filterValue {
+		a, b := l(rec), r(rec)
+		if a.kind == missingKind || b.kind == missingKind {
+			return filterValue{kind: boolKind}
+		}
+		return filterValue{kind: boolKind, b: compareValues(a, op, b)}
+	}
+
+	return node, nil
+}
+
+func compareValues(a filterValue, op string, b filterValue) bool {
+	c := 0
+	switch a.kind {
+	case numberKind:
+		switch {
+		case a.num < b.num:
+			c = -1
+		case a.num > b.num:
+			c = 1
+		}
+	case stringKind:
+		c = strings.Compare(a.str, b.str)
+	case boolKind:
+		if a.b != b.b {
+			c = 1
+		}
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func (p *filterParser) operand() (filterNode, error) {
+	tok := p.tok
+	at := p.at
+
+	switch {
+	case tok == "":
+		return filterNode{}, p.errorf("expression ends early")
+
+	case tok == "(":
+		err := p.next()
+		if err != nil {
+			return filterNode{}, err
+		}
+		n, err := p.or()
+		if err != nil {
+			return n, err
+		}
+		if p.tok != ")" {
+			return n, p.errorf("expected )")
+		}
+		return n, p.next()
+
+	case tok[0] == '"':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return filterNode{}, fmt.Errorf("filter at offset %d: bad string %s", at, tok)
+		}
+		return literalNode(filterValue{kind: stringKind, str: s}), p.next()
+
+	case tok[0] == '-' || tok[0] == '.' || tok[0] >= '0' && tok[0] <= '9':
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return filterNode{}, fmt.Errorf("filter at offset %d: bad number %s", at, tok)
+		}
+		return literalNode(filterValue{kind: numberKind, num: f}), p.next()
+
+	case tok == "true" || tok == "false":
+		return literalNode(filterValue{kind: boolKind, b: tok == "true"}), p.next()
+	}
+
+	field, ok := filterFields[tok]
+	if !ok {
+		return filterNode{}, fmt.Errorf("filter at offset %d: unknown field %q", at, tok)
+	}
+	return filterNode{kind: field.kind, field: true, eval: field.value}, p.next()
+}
+
+func literalNode(v filterValue) filterNode {
+	return filterNode{kind: v.kind, literal: &v, eval: func(*SenMLRecord) filterValue { return v }}
+}
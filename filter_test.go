@@ -0,0 +1,60 @@
+package senml_test
+
+import (
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`n =~ "temp.*" && v > 15 && u == "Cel"`, "room1/temp"},
+		{`v >= 20 || vb`, "room1/temp,room1/hum,room1/light"},
+		{`!(v < 30) && v`, "room1/hum"},
+		{`vs`, "room1/label"},
+		{`vs != "kitchen"`, ""},
+		{`vb == true`, "room1/light"},
+		{`n !~ "^room1/(temp|hum)$"`, "room1/light,room1/label"},
+		{`t > 1600000015 && t <= 1600000030`, "room1/light,room1/label"},
+		{`v > -5.5e1 && u == "%RH"`, "room1/hum"},
+	}
+	for _, test := range tests {
+		f, err := senml.CompileFilter(test.expr)
+		if err != nil {
+			t.Fatalf("CompileFilter of %q got %v", test.expr, err)
+		}
+		s, err := f.Apply(senml.Normalize(pipelinePack()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(s); got != test.want {
+			t.Errorf("Filter %q got %s", test.expr, got)
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``, `v >`, `v > "x"`, `n == 3`, `vb < true`, `n =~ v`, `v =~ "x"`,
+		`n =~ "("`, `(v > 3`, `x == 1`, `v > 3 3`, `"unterminated`, `3`, `v @ 3`,
+	} {
+		_, err := senml.CompileFilter(expr)
+		if err == nil {
+			t.Errorf("CompileFilter of %q should fail", expr)
+		}
+	}
+}
+
+func TestPipelineWhere(t *testing.T) {
+	p, err := senml.ParsePipeline(`where v > 30; rename room1/* r/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := p.Apply(pipelinePack())
+	if err != nil || names(s) != "r/hum" {
+		t.Error("Pipeline with where got", names(s), err)
+	}
+}
@@ -0,0 +1,226 @@
+package senml
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Series describes one generated measurement of each device
+type Series struct {
+	Name string
+	Unit string
+	// Shape is "sine" for a wave over Period seconds, "walk" for a random
+	// walk or "step" for a value switching between Min and Max every half
+	// Period
+	Shape  string
+	Min    float64
+	Max    float64
+	Period float64
+	// Noise is the standard deviation of the noise added to sine values and
+	// of the steps of a walk
+	Noise float64
+}
+
+// GenerateOptions configures a Generator
+type GenerateOptions struct {
+	// Devices is the number of devices, named NamePrefix followed by the
+	// device number
+	Devices    int
+	NamePrefix string
+	Series     []Series
+	// Start is the time of the first sample, zero for now
+	Start float64
+	// Interval is the seconds between samples
+	Interval float64
+	// PackSamples is the number of samples of each series in a pack
+	PackSamples int
+	// Compact moves the device name, first time and shared unit of each pack
+	// into base fields
+	Compact bool
+	// Seed starts the random numbers, so the same seed and Start give the
+	// same packs
+	Seed int64
+}
+
+// DefaultSeries is generated when GenerateOptions names no series
+var DefaultSeries = []Series{
+	{Name: "temperature", Unit: "Cel", Shape: "sine", Min: 15, Max: 25, Period: 86400, Noise: 0.1},
+	{Name: "humidity", Unit: "%RH", Shape: "walk", Min: 30, Max: 70, Noise: 0.5},
+	{Name: "door", Unit: "/", Shape: "step", Min: 0, Max: 1, Period: 600},
+}
+
+// Generator makes packs of synthetic records for load tests. Each call to
+// Next returns the next pack of one device, taking the devices in turn.
+type Generator struct {
+	options GenerateOptions
+	rand    *rand.Rand
+
+	device int
+	time   float64
+	// phase and last hold the phase and last value of each series of each
+	// device
+	phase [][]float64
+	last  [][]float64
+}
+
+// NewGenerator returns a Generator for the options, or an error for a series
+// it can not generate
+func NewGenerator(options GenerateOptions) (*Generator, error) {
+	if options.Devices <= 0 {
+		options.Devices = 1
+	}
+	if options.NamePrefix == "" {
+		options.NamePrefix = "dev"
+	}
+	if len(options.Series) == 0 {
+		options.Series = DefaultSeries
+	}
+	if options.Interval <= 0 {
+		options.Interval = 1
+	}
+	if options.PackSamples <= 0 {
+		options.PackSamples = 1
+	}
+	if options.Start == 0 {
+		options.Start = float64(time.Now().Unix())
+	}
+	for _, series := range options.Series {
+		switch {
+		case series.Shape != "sine" && series.Shape != "walk" && series.Shape != "step":
+			return nil, fmt.Errorf("series %s has unknown shape %q", series.Name, series.Shape)
+		case series.Max < series.Min:
+			return nil, fmt.Errorf("series %s has a max below its min", series.Name)
+		case series.Shape != "walk" && series.Period <= 0:
+			return nil, fmt.Errorf("series %s needs a period", series.Name)
+		}
+	}
+
+	g := &Generator{
+		options: options,
+		rand:    rand.New(rand.NewSource(options.Seed)),
+		time:    options.Start,
+	}
+	for d := 0; d < options.Devices; d++ {
+		phase := make([]float64, len(options.Series))
+		last := make([]float64, len(options.Series))
+		for i, series := range options.Series {
+			phase[i] = g.rand.Float64()
+			last[i] = series.Min + g.rand.Float64()*(series.Max-series.Min)
+		}
+		g.phase = append(g.phase, phase)
+		g.last = append(g.last, last)
+	}
+
+	return g, nil
+}
+
+// value returns the next value of a series of a device at time t
+func (g *Generator) value(device int, i int, t float64) float64 {
+	series := g.options.Series[i]
+	cycle := t/series.Period + g.phase[device][i]
+
+	var v float64
+	switch series.Shape {
+	case "sine":
+		mid := (series.Max + series.Min) / 2
+		amplitude := (series.Max - series.Min) / 2
+		v = mid + amplitude*math.Sin(2*math.Pi*cycle) + g.rand.NormFloat64()*series.Noise
+	case "walk":
+		step := series.Noise
+		if step == 0 {
+			step = (series.Max - series.Min) / 100
+		}
+		v = g.last[device][i] + g.rand.NormFloat64()*step
+		v = math.Max(series.Min, math.Min(series.Max, v))
+	case "step":
+		v = series.Min
+		if cycle-math.Floor(cycle) >= 0.5 {
+			v = series.Max
+		}
+	}
+	g.last[device][i] = v
+
+	// keep the digits a sensor would report
+	return math.Round(v*1000) / 1000
+}
+
+// Next returns the next pack
+func (g *Generator) Next() SenML {
+	var s SenML
+	s.Xmlns = "urn:ietf:params:xml:ns:senml"
+
+	device := g.device
+	prefix := g.options.NamePrefix + strconv.Itoa(device) + "/"
+	for n := 0; n < g.options.PackSamples; n++ {
+		t := g.time + float64(n)*g.options.Interval
+		for i, series := range g.options.Series {
+			v := g.value(device, i, t)
+			s.Records = append(s.Records, SenMLRecord{
+				Name:  prefix + series.Name,
+				Unit:  series.Unit,
+				Time:  t,
+				Value: &v,
+			})
+		}
+	}
+
+	g.device += 1
+	if g.device == g.options.Devices {
+		g.device = 0
+		g.time += float64(g.options.PackSamples) * g.options.Interval
+	}
+
+	if g.options.Compact {
+		s = Compact(s)
+	}
+	return s
+}
+
+// Generate returns count packs from a new Generator
+func Generate(options GenerateOptions, count int) ([]SenML, error) {
+	g, err := NewGenerator(options)
+	if err != nil {
+		return nil, err
+	}
+
+	packs := make([]SenML, count)
+	for i := range packs {
+		packs[i] = g.Next()
+	}
+	return packs, nil
+}
+
+// ParseSeries reads series separated by commas, each written as
+// name:unit:shape:min:max[:period[:noise]], such as
+// "temp:Cel:sine:15:25:86400,door:/:step:0:1:600".
+func ParseSeries(spec string) ([]Series, error) {
+	var ret []Series
+
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 5 || len(fields) > 7 {
+			return nil, fmt.Errorf("series %q is not name:unit:shape:min:max[:period[:noise]]", part)
+		}
+
+		series := Series{Name: fields[0], Unit: fields[1], Shape: fields[2]}
+		numbers := []*float64{&series.Min, &series.Max, &series.Period, &series.Noise}
+		for i, field := range fields[3:] {
+			var err error
+			*numbers[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("series %q: %v", part, err)
+			}
+		}
+		if series.Name == "" {
+			return nil, errors.New("series with no name")
+		}
+		ret = append(ret, series)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,80 @@
+package senml_test
+
+import (
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestGenerate(t *testing.T) {
+	series, err := senml.ParseSeries("temp:Cel:sine:15:25:3600:0.1, hum:%RH:walk:30:70, door:/:step:0:1:600")
+	if err != nil {
+		t.Fatal("ParseSeries failed", err)
+	}
+	options := senml.GenerateOptions{
+		Devices:     3,
+		Series:      series,
+		Start:       1600000000,
+		Interval:    10,
+		PackSamples: 4,
+		Seed:        1,
+	}
+	packs, err := senml.Generate(options, 7)
+	if err != nil {
+		t.Fatal("Generate failed", err)
+	}
+
+	if len(packs) != 7 || len(packs[0].Records) != 12 {
+		t.Fatal("Generate got", len(packs), "packs of", len(packs[0].Records))
+	}
+	if r := packs[1].Records[0]; r.Name != "dev1/temp" || r.Time != 1600000000 {
+		t.Error("second pack starts with", r)
+	}
+	if r := packs[3].Records[0]; r.Name != "dev0/temp" || r.Time != 1600000040 {
+		t.Error("fourth pack starts with", r)
+	}
+	for _, s := range packs {
+		if !senml.IsValid(s) {
+			t.Error("Generate made a pack that is not valid", s)
+		}
+		for _, r := range s.Records {
+			v := *r.Value
+			switch {
+			case r.Name[5:] == "hum" && (v < 30 || v > 70):
+				t.Error("walk left its range", r)
+			case r.Name[5:] == "door" && v != 0 && v != 1:
+				t.Error("step took a value between", r)
+			case r.Name[5:] == "temp" && (v < 14 || v > 26):
+				t.Error("sine left its range", r)
+			}
+		}
+	}
+
+	again, _ := senml.Generate(options, 7)
+	if *again[6].Records[5].Value != *packs[6].Records[5].Value {
+		t.Error("Generate with the same seed differs")
+	}
+
+	options.Compact = true
+	compact, _ := senml.Generate(options, 1)
+	if r := compact[0].Records[0]; r.BaseName != "dev0/" || r.BaseTime != 1600000000 {
+		t.Error("compact pack starts with", r)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, spec := range []string{"temp", "temp:Cel:sine:a:1", "temp:Cel:sine:1:2:3:4:5"} {
+		if _, err := senml.ParseSeries(spec); err == nil {
+			t.Error("ParseSeries took", spec)
+		}
+	}
+	for _, series := range []senml.Series{
+		{Name: "x", Shape: "square", Min: 0, Max: 1, Period: 1},
+		{Name: "x", Shape: "walk", Min: 1, Max: 0},
+		{Name: "x", Shape: "sine", Min: 0, Max: 1},
+	} {
+		if _, err := senml.NewGenerator(senml.GenerateOptions{Series: []senml.Series{series}}); err == nil {
+			t.Error("NewGenerator took", series)
+		}
+	}
+}
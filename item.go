@@ -0,0 +1,553 @@
+package senml
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+type itemKind int
+
+const (
+	uintItem   itemKind = iota // unsigned integer u sent in size extra bytes
+	negItem                    // negative integer -1-u sent in size extra bytes
+	floatItem                  // float f sent in size bytes
+	bytesItem                  // byte string b
+	textItem                   // text string b
+	arrayItem                  // items
+	mapItem                    // items hold the keys and values alternating
+	tagItem                    // CBOR tag u of items[0]
+	simpleItem                 // CBOR simple value u, also used for nil and booleans
+	extItem                    // MessagePack extension of type int8(u) holding b
+)
+
+// CBOR simple values
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+)
+
+// maxItemDepth bounds the nesting of arrays, maps and tags in a message
+const maxItemDepth = 64
+
+// item is a generic value read from a CBOR or MessagePack message. Unlike the
+// values produced by the codec package it keeps map entries in the order they
+// were sent, including any duplicates, and remembers how numbers were sent.
+type item struct {
+	kind       itemKind
+	u          uint64
+	f          float64
+	size       int
+	b          []byte
+	items      []item
+	indefinite bool
+}
+
+var errShortItem = errors.New("unexpected end of data")
+var errDeepItem = errors.New("data nested too deeply")
+
+func (it item) text() (string, bool) {
+	if it.kind == textItem {
+		return string(it.b), true
+	}
+	return "", false
+}
+
+func (it item) int() (int64, bool) {
+	switch {
+	case it.kind == uintItem && it.u <= math.MaxInt64:
+		return int64(it.u), true
+	case it.kind == negItem && it.u <= math.MaxInt64:
+		return -1 - int64(it.u), true
+	}
+	return 0, false
+}
+
+func (it item) isNumber() bool {
+	return it.kind == uintItem || it.kind == negItem || it.kind == floatItem
+}
+
+func (it item) isBool() bool {
+	return it.kind == simpleItem && (it.u == simpleFalse || it.u == simpleTrue)
+}
+
+// readCBOR reads one CBOR data item from the start of data and returns it
+// along with the number of bytes it used.
+func readCBOR(data []byte) (item, int, error) {
+	return readCBORItem(data, 0)
+}
+
+func readCBORArg(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 0, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), 1, nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), 2, nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), 4, nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), 8, nil
+	case info >= 28 && info <= 30:
+		return 0, 0, errors.New("reserved CBOR additional information")
+	}
+	return 0, 0, errShortItem
+}
+
+func readCBORItem(data []byte, depth int) (item, int, error) {
+	var it item
+
+	if depth > maxItemDepth {
+		return it, 0, errDeepItem
+	}
+	if len(data) < 1 {
+		return it, 0, errShortItem
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	pos := 1
+
+	if info == 31 {
+		return readCBORIndefinite(data, major, depth)
+	}
+	arg, n, err := readCBORArg(data[pos:], info)
+	if err != nil {
+		return it, 0, err
+	}
+	pos += n
+
+	switch major {
+	case 0:
+		it.kind = uintItem
+		it.u = arg
+		it.size = n
+	case 1:
+		it.kind = negItem
+		it.u = arg
+		it.size = n
+	case 2, 3:
+		it.kind = bytesItem
+		if major == 3 {
+			it.kind = textItem
+		}
+		if arg > uint64(len(data)-pos) {
+			return it, 0, errShortItem
+		}
+		it.b = data[pos : pos+int(arg)]
+		pos += int(arg)
+	case 4, 5:
+		it.kind = arrayItem
+		count := arg
+		if major == 5 {
+			it.kind = mapItem
+			count = arg * 2
+		}
+		if count > uint64(len(data)-pos) {
+			return it, 0, errShortItem
+		}
+		it.items = make([]item, 0, count)
+		for i := uint64(0); i < count; i++ {
+			sub, n, err := readCBORItem(data[pos:], depth+1)
+			if err != nil {
+				return it, 0, err
+			}
+			it.items = append(it.items, sub)
+			pos += n
+		}
+	case 6:
+		it.kind = tagItem
+		it.u = arg
+		sub, n, err := readCBORItem(data[pos:], depth+1)
+		if err != nil {
+			return it, 0, err
+		}
+		it.items = []item{sub}
+		pos += n
+	case 7:
+		switch info {
+		case 25:
+			it.kind = floatItem
+			it.f = halfToFloat(uint16(arg))
+			it.size = 2
+		case 26:
+			it.kind = floatItem
+			it.f = float64(math.Float32frombits(uint32(arg)))
+			it.size = 4
+		case 27:
+			it.kind = floatItem
+			it.f = math.Float64frombits(arg)
+			it.size = 8
+		default:
+			it.kind = simpleItem
+			it.u = arg
+		}
+	}
+
+	return it, pos, nil
+}
+
+func readCBORIndefinite(data []byte, major byte, depth int) (item, int, error) {
+	var it item
+	it.indefinite = true
+	pos := 1
+
+	switch major {
+	case 2, 3:
+		it.kind = bytesItem
+		if major == 3 {
+			it.kind = textItem
+		}
+		it.b = []byte{}
+	case 4:
+		it.kind = arrayItem
+	case 5:
+		it.kind = mapItem
+	default:
+		return it, 0, errors.New("unexpected CBOR break")
+	}
+
+	for {
+		if pos >= len(data) {
+			return it, 0, errShortItem
+		}
+		if data[pos] == 0xff {
+			pos += 1
+			break
+		}
+		sub, n, err := readCBORItem(data[pos:], depth+1)
+		if err != nil {
+			return it, 0, err
+		}
+		pos += n
+		if major == 2 || major == 3 {
+			if sub.kind != it.kind || sub.indefinite {
+				return it, 0, errors.New("bad chunk in CBOR string")
+			}
+			it.b = append(it.b, sub.b...)
+		} else {
+			it.items = append(it.items, sub)
+		}
+	}
+	if major == 5 && len(it.items)%2 != 0 {
+		return it, 0, errors.New("CBOR map has a key with no value")
+	}
+
+	return it, pos, nil
+}
+
+// halfToFloat converts an IEEE 754 half precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// readMsgpack reads one MessagePack object from the start of data and
+// returns it along with the number of bytes it used.
+func readMsgpack(data []byte) (item, int, error) {
+	return readMsgpackItem(data, 0)
+}
+
+func readMsgpackItem(data []byte, depth int) (item, int, error) {
+	var it item
+
+	if depth > maxItemDepth {
+		return it, 0, errDeepItem
+	}
+	if len(data) < 1 {
+		return it, 0, errShortItem
+	}
+	b := data[0]
+	pos := 1
+
+	// size reads a big endian length or value of n bytes
+	size := func(n int) (uint64, bool) {
+		if len(data)-pos < n {
+			return 0, false
+		}
+		var v uint64
+		for i := 0; i < n; i++ {
+			v = v<<8 | uint64(data[pos+i])
+		}
+		pos += n
+		return v, true
+	}
+
+	var length uint64
+	var ok = true
+	switch {
+	case b <= 0x7f:
+		it.kind = uintItem
+		it.u = uint64(b)
+		return it, pos, nil
+	case b >= 0xe0:
+		it.kind = negItem
+		it.u = uint64(-1 - int64(int8(b)))
+		return it, pos, nil
+	case b >= 0x80 && b <= 0x8f:
+		it.kind = mapItem
+		length = uint64(b & 0x0f)
+	case b >= 0x90 && b <= 0x9f:
+		it.kind = arrayItem
+		length = uint64(b & 0x0f)
+	case b >= 0xa0 && b <= 0xbf:
+		it.kind = textItem
+		length = uint64(b & 0x1f)
+	case b == 0xc0:
+		it.kind = simpleItem
+		it.u = simpleNull
+		return it, pos, nil
+	case b == 0xc2 || b == 0xc3:
+		it.kind = simpleItem
+		it.u = simpleFalse + uint64(b-0xc2)
+		return it, pos, nil
+	case b >= 0xc4 && b <= 0xc6:
+		it.kind = bytesItem
+		length, ok = size(1 << (b - 0xc4))
+	case b >= 0xc7 && b <= 0xc9:
+		it.kind = extItem
+		length, ok = size(1 << (b - 0xc7))
+	case b == 0xca:
+		v, ok := size(4)
+		if !ok {
+			return it, 0, errShortItem
+		}
+		it.kind = floatItem
+		it.f = float64(math.Float32frombits(uint32(v)))
+		it.size = 4
+		return it, pos, nil
+	case b == 0xcb:
+		v, ok := size(8)
+		if !ok {
+			return it, 0, errShortItem
+		}
+		it.kind = floatItem
+		it.f = math.Float64frombits(v)
+		it.size = 8
+		return it, pos, nil
+	case b >= 0xcc && b <= 0xcf:
+		v, ok := size(1 << (b - 0xcc))
+		if !ok {
+			return it, 0, errShortItem
+		}
+		it.kind = uintItem
+		it.u = v
+		return it, pos, nil
+	case b >= 0xd0 && b <= 0xd3:
+		n := 1 << (b - 0xd0)
+		v, ok := size(n)
+		if !ok {
+			return it, 0, errShortItem
+		}
+		// sign extend the value
+		i := int64(v<<(64-8*uint(n))) >> (64 - 8*uint(n))
+		if i >= 0 {
+			it.kind = uintItem
+			it.u = uint64(i)
+		} else {
+			it.kind = negItem
+			it.u = uint64(-1 - i)
+		}
+		return it, pos, nil
+	case b >= 0xd4 && b <= 0xd8:
+		it.kind = extItem
+		length = 1 << (b - 0xd4)
+	case b >= 0xd9 && b <= 0xdb:
+		it.kind = textItem
+		length, ok = size(1 << (b - 0xd9))
+	case b == 0xdc || b == 0xdd:
+		it.kind = arrayItem
+		length, ok = size(2 << (b - 0xdc))
+	case b == 0xde || b == 0xdf:
+		it.kind = mapItem
+		length, ok = size(2 << (b - 0xde))
+	default:
+		return it, 0, errors.New("unused MessagePack type")
+	}
+	if !ok {
+		return it, 0, errShortItem
+	}
+
+	switch it.kind {
+	case extItem:
+		if len(data)-pos < 1 {
+			return it, 0, errShortItem
+		}
+		it.u = uint64(data[pos])
+		pos += 1
+		fallthrough
+	case bytesItem, textItem:
+		if length > uint64(len(data)-pos) {
+			return it, 0, errShortItem
+		}
+		it.b = data[pos : pos+int(length)]
+		pos += int(length)
+	case arrayItem, mapItem:
+		if it.kind == mapItem {
+			length *= 2
+		}
+		if length > uint64(len(data)-pos) {
+			return it, 0, errShortItem
+		}
+		it.items = make([]item, 0, length)
+		for i := uint64(0); i < length; i++ {
+			sub, n, err := readMsgpackItem(data[pos:], depth+1)
+			if err != nil {
+				return it, 0, err
+			}
+			it.items = append(it.items, sub)
+			pos += n
+		}
+	}
+
+	return it, pos, nil
+}
+
+// argSize returns the number of extra bytes the shortest CBOR head for arg
+// needs
+func argSize(arg uint64) int {
+	switch {
+	case arg < 24:
+		return 0
+	case arg <= math.MaxUint8:
+		return 1
+	case arg <= math.MaxUint16:
+		return 2
+	case arg <= math.MaxUint32:
+		return 4
+	}
+	return 8
+}
+
+// appendCBORHead appends a CBOR head with the argument in size extra bytes,
+// or the fewest bytes possible if size is too small to hold it
+func appendCBORHead(buf []byte, major byte, arg uint64, size int) []byte {
+	if min := argSize(arg); size < min {
+		size = min
+	}
+	major <<= 5
+	switch size {
+	case 0:
+		return append(buf, major|byte(arg))
+	case 1:
+		return append(buf, major|24, byte(arg))
+	case 2:
+		return append(buf, major|25, byte(arg>>8), byte(arg))
+	case 4:
+		buf = append(buf, major|26)
+		return append(buf, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+	}
+	buf = append(buf, major|27)
+	for shift := 56; shift >= 0; shift -= 8 {
+		buf = append(buf, byte(arg>>uint(shift)))
+	}
+	return buf
+}
+
+// appendCBOR appends the CBOR encoding of an item
+func appendCBOR(buf []byte, it item) []byte {
+	switch it.kind {
+	case uintItem:
+		return appendCBORHead(buf, 0, it.u, it.size)
+
+	case negItem:
+		return appendCBORHead(buf, 1, it.u, it.size)
+
+	case floatItem:
+		switch it.size {
+		case 2:
+			return appendCBORHead(buf, 7, uint64(floatToHalf(it.f)), 2)
+		case 4:
+			return appendCBORHead(buf, 7, uint64(math.Float32bits(float32(it.f))), 4)
+		}
+		return appendCBORHead(buf, 7, math.Float64bits(it.f), 8)
+
+	case bytesItem, textItem:
+		major := byte(2)
+		if it.kind == textItem {
+			major = 3
+		}
+		if it.indefinite {
+			buf = append(buf, major<<5|31)
+			buf = appendCBORHead(buf, major, uint64(len(it.b)), 0)
+			buf = append(buf, it.b...)
+			return append(buf, 0xff)
+		}
+		buf = appendCBORHead(buf, major, uint64(len(it.b)), 0)
+		return append(buf, it.b...)
+
+	case arrayItem, mapItem:
+		major := byte(4)
+		count := len(it.items)
+		if it.kind == mapItem {
+			major = 5
+			count /= 2
+		}
+		if it.indefinite {
+			buf = append(buf, major<<5|31)
+		} else {
+			buf = appendCBORHead(buf, major, uint64(count), 0)
+		}
+		for _, sub := range it.items {
+			buf = appendCBOR(buf, sub)
+		}
+		if it.indefinite {
+			buf = append(buf, 0xff)
+		}
+		return buf
+
+	case tagItem:
+		buf = appendCBORHead(buf, 6, it.u, 0)
+		return appendCBOR(buf, it.items[0])
+
+	case simpleItem:
+		if it.u >= 24 && it.u < 32 {
+			// reserved simple values are written as is
+			return append(buf, 0xf8, byte(it.u))
+		}
+		return appendCBORHead(buf, 7, it.u, 0)
+	}
+
+	return buf
+}
+
+// floatToHalf converts to an IEEE 754 half precision float, rounding toward
+// zero
+func floatToHalf(f float64) uint16 {
+	bits := math.Float32bits(float32(f))
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case math.IsNaN(f):
+		return sign | 0x7e00
+	case exp >= 31:
+		return sign | 0x7c00
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		return sign | uint16(mant>>uint(14-exp))
+	}
+	return sign | uint16(exp)<<10 | uint16(mant>>13)
+}
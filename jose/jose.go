@@ -0,0 +1,118 @@
+// Package jose protects JSON encoded SenML packs with JOSE. Packs can be
+// signed as a JWS (RFC 7515) or encrypted as a JWE (RFC 7516), both in the
+// compact serialization. Keys are supplied by the caller.
+package jose
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/cisco/senml"
+)
+
+// contentType is the cty header for application/senml+json payloads
+const contentType = "senml+json"
+
+var ErrNotJOSE = errors.New("not a JWS or JWE in compact serialization")
+var ErrVerify = errors.New("JWS signature does not verify")
+var ErrDecrypt = errors.New("JWE does not decrypt")
+var ErrKeyType = errors.New("key type not supported for this algorithm")
+
+// header holds the protected header fields used here
+type header struct {
+	Alg  string   `json:"alg"`
+	Enc  string   `json:"enc,omitempty"`
+	Cty  string   `json:"cty,omitempty"`
+	Kid  string   `json:"kid,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func encodeHeader(h header) (string, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(data), nil
+}
+
+func decodeHeader(part string) (header, error) {
+	var h header
+
+	data, err := b64.DecodeString(part)
+	if err != nil {
+		return h, err
+	}
+	err = json.Unmarshal(data, &h)
+	if err != nil {
+		return h, err
+	}
+	if len(h.Crit) > 0 {
+		return h, errors.New("JOSE header has critical extensions that are not understood")
+	}
+	return h, nil
+}
+
+// split returns the parts of a compact serialization, checking their number
+func split(token string, want int) ([]string, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != want {
+		return nil, ErrNotJOSE
+	}
+	return parts, nil
+}
+
+// IsJWS tells if the token looks like a JWS in compact serialization
+func IsJWS(token []byte) bool {
+	return looksCompact(token, 3)
+}
+
+// IsJWE tells if the token looks like a JWE in compact serialization
+func IsJWE(token []byte) bool {
+	return looksCompact(token, 5)
+}
+
+func looksCompact(token []byte, parts int) bool {
+	dots := 0
+	for _, c := range strings.TrimSpace(string(token)) {
+		switch {
+		case c == '.':
+			dots += 1
+		case c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		default:
+			return false
+		}
+	}
+	return dots == parts-1
+}
+
+// KeyID returns the kid header of a JWS or JWE so the caller can pick the key
+// to check or decrypt it with.
+func KeyID(token string) (string, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return "", ErrNotJOSE
+	}
+	h, err := decodeHeader(strings.TrimSpace(token[:i]))
+	return h.Kid, err
+}
+
+// Decode verifies a JWS, or decrypts a JWE, and decodes the JSON SenML pack
+// it carries.
+func Decode(token string, key interface{}) (senml.SenML, error) {
+	var payload []byte
+	var err error
+
+	if IsJWE([]byte(token)) {
+		payload, err = Decrypt(token, key)
+	} else {
+		payload, err = Verify(token, key)
+	}
+	if err != nil {
+		return senml.SenML{}, err
+	}
+	return senml.Decode(payload, senml.JSON)
+}
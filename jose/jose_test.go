@@ -0,0 +1,120 @@
+package jose_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cisco/senml"
+	"github.com/cisco/senml/jose"
+)
+
+func testPack() senml.SenML {
+	value := 22.1
+	return senml.SenML{
+		Records: []senml.SenMLRecord{
+			{BaseName: "dev123/", Name: "temp", Unit: "Cel", Value: &value},
+		},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+
+	for _, key := range []interface{}{hmacKey, ecKey, edKey, rsaKey} {
+		token, err := jose.Sign(testPack(), key, "dev123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !jose.IsJWS([]byte(token)) {
+			t.Error("IsJWS is false for", token)
+		}
+		kid, err := jose.KeyID(token)
+		if err != nil || kid != "dev123" {
+			t.Error("KeyID got", kid, err)
+		}
+
+		s, err := jose.Decode(token, key)
+		if err != nil {
+			t.Fatalf("Decode with %T got %v", key, err)
+		}
+		if len(s.Records) != 1 || s.Records[0].Name != "temp" {
+			t.Error("Decode of JWS got", s.Records)
+		}
+
+		parts := strings.Split(token, ".")
+		other, _ := jose.Sign(senml.SenML{Records: []senml.SenMLRecord{{Name: "x", StringValue: "y"}}}, key, "")
+		forged := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+		_, err = jose.Verify(forged, key)
+		if !errors.Is(err, jose.ErrVerify) {
+			t.Errorf("Verify of a changed payload with %T got %v", key, err)
+		}
+	}
+
+	// an HMAC keyed with the public key must not pass for a signature
+	token, _ := jose.Sign(testPack(), ecKey, "")
+	_, err = jose.Verify(token, []byte("public key bytes"))
+	if !errors.Is(err, jose.ErrVerify) {
+		t.Error("Verify with an HMAC key got", err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key128 := []byte("0123456789abcdef")
+	key256 := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alg string
+		enc string
+		key interface{}
+	}{
+		{"dir", "A128GCM", key128},
+		{"dir", "A256GCM", key256},
+		{"A128KW", "A256GCM", key128},
+		{"A256KW", "A128GCM", key256},
+		{"RSA-OAEP-256", "A128GCM", rsaKey},
+	}
+	for _, test := range tests {
+		token, err := jose.Encrypt(testPack(), test.alg, test.enc, test.key, "k1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !jose.IsJWE([]byte(token)) {
+			t.Error("IsJWE is false for", token)
+		}
+		s, err := jose.Decode(token, test.key)
+		if err != nil {
+			t.Fatalf("Decode of %s %s got %v", test.alg, test.enc, err)
+		}
+		if len(s.Records) != 1 || s.Records[0].Unit != "Cel" {
+			t.Error("Decode of JWE got", s.Records)
+		}
+
+		parts := strings.Split(token, ".")
+		parts[4] = strings.Repeat("A", len(parts[4]))
+		_, err = jose.Decrypt(strings.Join(parts, "."), test.key)
+		if !errors.Is(err, jose.ErrDecrypt) {
+			t.Errorf("Decrypt of a changed tag for %s got %v", test.alg, err)
+		}
+	}
+
+	_, err = jose.Encrypt(testPack(), "dir", "A256GCM", key128, "")
+	if !errors.Is(err, jose.ErrKeyType) {
+		t.Error("Encrypt with a short key got", err)
+	}
+}
@@ -0,0 +1,207 @@
+package jose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/cisco/senml"
+)
+
+// keySizes gives the content encryption key size for each enc value
+var keySizes = map[string]int{
+	"A128GCM": 16,
+	"A192GCM": 24,
+	"A256GCM": 32,
+}
+
+// Encrypt encodes the pack as JSON and encrypts it as a compact JWE. The alg
+// may be "dir" or "A128KW", "A192KW" or "A256KW" with a byte slice key, or
+// "RSA-OAEP-256" with an RSA key. The enc must be one of the AES-GCM
+// algorithms.
+func Encrypt(s senml.SenML, alg string, enc string, key interface{}, kid string) (string, error) {
+	payload, err := senml.Encode(s, senml.JSON, senml.OutputOptions{})
+	if err != nil {
+		return "", err
+	}
+	return EncryptPayload(payload, alg, enc, key, kid)
+}
+
+// EncryptPayload is like Encrypt for a payload that is already encoded.
+func EncryptPayload(payload []byte, alg string, enc string, key interface{}, kid string) (string, error) {
+	size, ok := keySizes[enc]
+	if !ok {
+		return "", errors.New("JWE content encryption not supported")
+	}
+
+	var cek, encryptedKey []byte
+	var err error
+	switch {
+	case alg == "dir":
+		k, ok := key.([]byte)
+		if !ok || len(k) != size {
+			return "", ErrKeyType
+		}
+		cek = k
+
+	case alg == "A128KW" || alg == "A192KW" || alg == "A256KW":
+		k, ok := key.([]byte)
+		if !ok || len(k) != wrapKeySize(alg) {
+			return "", ErrKeyType
+		}
+		cek, err = randomBytes(size)
+		if err != nil {
+			return "", err
+		}
+		encryptedKey, err = wrapKey(k, cek)
+		if err != nil {
+			return "", err
+		}
+
+	case alg == "RSA-OAEP-256":
+		var pub *rsa.PublicKey
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			pub = k
+		case *rsa.PrivateKey:
+			pub = &k.PublicKey
+		default:
+			return "", ErrKeyType
+		}
+		cek, err = randomBytes(size)
+		if err != nil {
+			return "", err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		return "", errors.New("JWE key management algorithm not supported")
+	}
+
+	protected, err := encodeHeader(header{Alg: alg, Enc: enc, Cty: contentType, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext := sealed[:len(sealed)-gcm.Overhead()]
+	tag := sealed[len(sealed)-gcm.Overhead():]
+
+	return protected + "." + b64.EncodeToString(encryptedKey) + "." + b64.EncodeToString(iv) + "." +
+		b64.EncodeToString(ciphertext) + "." + b64.EncodeToString(tag), nil
+}
+
+// Decrypt opens a compact JWE and returns its payload. The key is a byte
+// slice for "dir" and the AES key wraps, and an RSA private key for
+// RSA-OAEP-256.
+func Decrypt(token string, key interface{}) ([]byte, error) {
+	parts, err := split(token, 5)
+	if err != nil {
+		return nil, err
+	}
+	h, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	size, ok := keySizes[h.Enc]
+	if !ok {
+		return nil, errors.New("JWE content encryption not supported")
+	}
+
+	var decoded [4][]byte
+	for i := range decoded {
+		decoded[i], err = b64.DecodeString(parts[i+1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+
+	var cek []byte
+	switch {
+	case h.Alg == "dir":
+		k, ok := key.([]byte)
+		if !ok || len(encryptedKey) != 0 {
+			return nil, ErrKeyType
+		}
+		cek = k
+
+	case h.Alg == "A128KW" || h.Alg == "A192KW" || h.Alg == "A256KW":
+		k, ok := key.([]byte)
+		if !ok || len(k) != wrapKeySize(h.Alg) {
+			return nil, ErrKeyType
+		}
+		cek, err = unwrapKey(k, encryptedKey)
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+
+	case h.Alg == "RSA-OAEP-256":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrKeyType
+		}
+		cek, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, k, encryptedKey, nil)
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+
+	default:
+		return nil, errors.New("JWE key management algorithm not supported")
+	}
+	if len(cek) != size {
+		return nil, ErrDecrypt
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	payload, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return payload, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// wrapKeySize gives the key encryption key size for an AES key wrap alg
+func wrapKeySize(alg string) int {
+	switch alg {
+	case "A128KW":
+		return 16
+	case "A192KW":
+		return 24
+	}
+	return 32
+}
@@ -0,0 +1,153 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/cisco/senml"
+)
+
+// signingAlg picks the JWS algorithm for a signing key
+func signingAlg(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return "", ErrKeyType
+		}
+		return "HS256", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrKeyType
+		}
+		return "ES256", nil
+	case ed25519.PrivateKey:
+		return "EdDSA", nil
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	}
+	return "", ErrKeyType
+}
+
+// Sign encodes the pack as JSON and signs it as a compact JWS. The algorithm
+// follows from the key: HS256 for a byte slice, ES256 for an ECDSA P-256 key,
+// EdDSA for an Ed25519 key and RS256 for an RSA key. The kid is left out when
+// empty.
+func Sign(s senml.SenML, key interface{}, kid string) (string, error) {
+	payload, err := senml.Encode(s, senml.JSON, senml.OutputOptions{})
+	if err != nil {
+		return "", err
+	}
+	return SignPayload(payload, key, kid)
+}
+
+// SignPayload is like Sign for a payload that is already encoded.
+func SignPayload(payload []byte, key interface{}, kid string) (string, error) {
+	alg, err := signingAlg(key)
+	if err != nil {
+		return "", err
+	}
+	protected, err := encodeHeader(header{Alg: alg, Cty: contentType, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	input := protected + "." + b64.EncodeToString(payload)
+
+	var sig []byte
+	digest := sha256.Sum256([]byte(input))
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(input))
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return input + "." + b64.EncodeToString(sig), nil
+}
+
+// Verify checks a compact JWS and returns its payload. The key may be public
+// or private, or a byte slice for HS256. The alg header must match the key,
+// so an HMAC can not pass for a signature.
+func Verify(token string, key interface{}) ([]byte, error) {
+	parts, err := split(token, 3)
+	if err != nil {
+		return nil, err
+	}
+	h, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	input := []byte(parts[0] + "." + parts[1])
+	if !verifySignature(h.Alg, key, input, sig) {
+		return nil, ErrVerify
+	}
+
+	return payload, nil
+}
+
+func verifySignature(alg string, key interface{}, input []byte, sig []byte) bool {
+	digest := sha256.Sum256(input)
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return verifySignature(alg, &k.PublicKey, input, sig)
+	case ed25519.PrivateKey:
+		return verifySignature(alg, k.Public(), input, sig)
+	case *rsa.PrivateKey:
+		return verifySignature(alg, &k.PublicKey, input, sig)
+
+	case []byte:
+		if alg != "HS256" || len(k) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), sig)
+
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || k.Curve != elliptic.P256() || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(k, input, sig)
+
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestKeyWrap checks the 128-bit key wrap example from section 4.1 of RFC 3394
+func TestKeyWrap(t *testing.T) {
+	kek, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	want, _ := hex.DecodeString("1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5")
+
+	wrapped, err := wrapKey(kek, key)
+	if err != nil || !bytes.Equal(wrapped, want) {
+		t.Errorf("wrapKey got %x %v", wrapped, err)
+	}
+	unwrapped, err := unwrapKey(kek, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("unwrapKey got %x %v", unwrapped, err)
+	}
+
+	wrapped[0] ^= 1
+	_, err = unwrapKey(kek, wrapped)
+	if err == nil {
+		t.Error("unwrapKey of a changed key should fail")
+	}
+}
@@ -0,0 +1,154 @@
+package senml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LineError reports a line of JSONLINE input that could not be decoded.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// JSONLineDecoder reads SenML records from a stream holding one JSON record
+// per line. Lines may end in "\n" or "\r\n" and blank lines are skipped.
+// Records are not validated since a record may depend on the base fields of
+// those before it.
+type JSONLineDecoder struct {
+	reader  *bufio.Reader
+	options DecodeOptions
+	strict  strictChecker
+	lim     *limits
+	report  DecodeReport
+	line    int
+	read    int
+}
+
+// NewJSONLineDecoder returns a decoder reading from r. The Strict, Lenient
+// and limit settings in options are applied to every line, with MaxBytes
+// and MaxRecords covering the whole stream.
+func NewJSONLineDecoder(r io.Reader, options DecodeOptions) *JSONLineDecoder {
+	if options.MaxBytes > 0 {
+		// read one byte past the limit to tell when it has been exceeded
+		r = io.LimitReader(r, int64(options.MaxBytes)+1)
+	}
+	return &JSONLineDecoder{
+		reader:  bufio.NewReader(r),
+		options: options,
+		strict:  newStrictChecker(options.Extensions),
+		lim:     newLimits(options),
+	}
+}
+
+// Next returns the next record in the stream, or io.EOF when there are no
+// more. A line that can not be decoded gives a *LineError, after which Next
+// may be called again to carry on with the following line.
+func (d *JSONLineDecoder) Next() (SenMLRecord, error) {
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return SenMLRecord{}, err
+		}
+		d.line += 1
+		d.read += len(line)
+		if d.options.MaxBytes > 0 && d.read > d.options.MaxBytes {
+			return SenMLRecord{}, fmt.Errorf("%w: stream longer than %d bytes", ErrLimitExceeded, d.options.MaxBytes)
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		r, err := d.decodeLine(line)
+		if err == nil {
+			err = d.lim.add(r)
+			if err != nil {
+				return SenMLRecord{}, err
+			}
+		}
+		if err != nil {
+			return SenMLRecord{}, &LineError{Line: d.line, Err: err}
+		}
+		return r, nil
+	}
+}
+
+// Line returns the number of the line the last record was read from.
+func (d *JSONLineDecoder) Line() int {
+	return d.line
+}
+
+// Report returns what has been noticed so far about the stream.
+func (d *JSONLineDecoder) Report() DecodeReport {
+	return d.report
+}
+
+func (d *JSONLineDecoder) decodeLine(line []byte) (SenMLRecord, error) {
+	var r SenMLRecord
+
+	if d.options.Strict {
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		err := d.strict.json(dec, false)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	if d.options.Lenient {
+		var v interface{}
+		err := json.Unmarshal(line, &v)
+		if err != nil {
+			return r, err
+		}
+		ld := lenientDecoder{format: JSONLINE, report: &d.report}
+		m, ok := ld.fields(v)
+		if !ok {
+			return r, errors.New("record is not an object")
+		}
+		return ld.record(m)
+	}
+
+	err := json.Unmarshal(line, &r)
+	return r, err
+}
+
+// decodeJSONLines decodes a whole JSONLINE message, skipping bad lines when
+// options.SkipBadLines is set
+func decodeJSONLines(msg []byte, options DecodeOptions, report *DecodeReport) ([]SenMLRecord, error) {
+	var records []SenMLRecord
+
+	d := NewJSONLineDecoder(bytes.NewReader(msg), options)
+	for {
+		r, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) && options.SkipBadLines {
+			report.Skipped = append(report.Skipped, lineErr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	report.Legacy = d.report.Legacy
+
+	return records, nil
+}
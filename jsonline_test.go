@@ -0,0 +1,91 @@
+package senml_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestJSONLineDecode(t *testing.T) {
+	data := []byte("{\"bn\":\"dev/\",\"n\":\"a\",\"v\":1}\r\n\r\n   \n{\"n\":\"b\",\"vs\":\"x\"}\r\n{\"n\":\"c\",\"vb\":false}")
+	s, err := senml.Decode(data, senml.JSONLINE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Records) != 3 || s.Records[2].BoolValue == nil {
+		t.Error("JSONLINE decode got", s.Records)
+	}
+}
+
+func TestJSONLineErrors(t *testing.T) {
+	data := []byte("{\"n\":\"a\",\"v\":1}\n{\"n\":\"b\",\"v\":\n{\"n\":\"c\",\"v\":3}\n[]\n")
+
+	_, err := senml.Decode(data, senml.JSONLINE)
+	var lineErr *senml.LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 {
+		t.Error("JSONLINE decode got", err)
+	}
+
+	s, report, err := senml.DecodeWithOptions(data, senml.JSONLINE, senml.DecodeOptions{SkipBadLines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Records) != 2 || len(report.Skipped) != 2 || report.Skipped[1].Line != 4 {
+		t.Error("JSONLINE decode skipping bad lines got", s.Records, report.Skipped)
+	}
+}
+
+func TestJSONLineDecoder(t *testing.T) {
+	d := senml.NewJSONLineDecoder(strings.NewReader("{\"n\":\"a\",\"v\":1}\nnope\n{\"n\":\"c\",\"v\":3}"), senml.DecodeOptions{})
+	var names []string
+	var bad []int
+	for {
+		r, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			bad = append(bad, d.Line())
+			continue
+		}
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "a,c" || len(bad) != 1 || bad[0] != 2 {
+		t.Error("JSONLineDecoder got", names, bad)
+	}
+
+	d = senml.NewJSONLineDecoder(strings.NewReader("{\"n\":\"a\",\"v\":1}\n{\"n\":\"b\",\"v\":2}\n"), senml.DecodeOptions{MaxRecords: 1})
+	d.Next()
+	_, err := d.Next()
+	if !errors.Is(err, senml.ErrLimitExceeded) {
+		t.Error("JSONLineDecoder over limit got", err)
+	}
+}
+
+func TestJSONLineEncodeAllRecords(t *testing.T) {
+	v := 1.0
+	b := true
+	s := senml.SenML{
+		Records: []senml.SenMLRecord{
+			{Name: "a", Value: &v},
+			{Name: "b", StringValue: "x"},
+			{Name: "c", BoolValue: &b},
+			{Name: "d", DataValue: "aGk"},
+			{Name: "e", Sum: &v},
+		},
+	}
+	data, err := senml.Encode(s, senml.JSONLINE, senml.OutputOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := senml.Decode(data, senml.JSONLINE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Records) != len(s.Records) {
+		t.Error("JSONLINE round trip got", string(data))
+	}
+}
@@ -0,0 +1,328 @@
+package senml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// labels maps the CBOR labels from RFC 8428 to the JSON field names
+var labels = map[int]string{
+	-1: "bver",
+	-2: "bn",
+	-3: "bt",
+	-4: "bu",
+	0:  "n",
+	1:  "u",
+	2:  "v",
+	3:  "vs",
+	4:  "vb",
+	5:  "s",
+	6:  "t",
+	7:  "ut",
+	8:  "vd",
+}
+
+// legacyNames maps the field names used by the SenML drafts to the names
+// used in RFC 8428
+var legacyNames = map[string]string{
+	"ver": "bver",
+	"sv":  "vs",
+	"bv":  "vb",
+}
+
+// lenientDecoder turns the generic maps produced by the JSON, XML, CBOR and
+// MessagePack parsers into records, accepting draft-era constructs on the way
+type lenientDecoder struct {
+	format Format
+	report *DecodeReport
+}
+
+func (c *Codec) decodeLenient(msg []byte, format Format, report *DecodeReport) ([]SenMLRecord, error) {
+	var pack interface{}
+	var err error
+
+	d := lenientDecoder{format: format, report: report}
+
+	switch {
+	case format == JSON:
+		err = json.Unmarshal(msg, &pack)
+
+	case format == XML:
+		return d.xml(msg)
+
+	case format == CBOR:
+		err = decode(&c.cborDecoders, msg, &pack)
+
+	case format == MPACK:
+		err = codec.NewDecoderBytes(msg, c.rawHandle).Decode(&pack)
+
+	default:
+		return nil, errors.New("lenient decoding not supported for this format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, ok := pack.([]interface{})
+	if ok {
+		return d.records(entries, nil)
+	}
+
+	// the drafts wrapped the records in an object holding the base fields
+	// and an "e" array with the entries
+	base, ok := d.fields(pack)
+	if !ok {
+		return nil, errors.New("SenML pack is not an array")
+	}
+	entries, ok = base["e"].([]interface{})
+	if !ok {
+		return nil, errors.New("SenML pack is not an array")
+	}
+	d.report.legacy(`"e" array of entries`)
+	delete(base, "e")
+
+	return d.records(entries, base)
+}
+
+// xml collects the attributes of every element as the fields of a record. A
+// draft style <senml> root element carries the base fields for the records.
+func (d lenientDecoder) xml(msg []byte) ([]SenMLRecord, error) {
+	var entries []interface{}
+	var base map[string]interface{}
+
+	decoder := xml.NewDecoder(bytes.NewReader(msg))
+	depth := 0
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth += 1
+			m := map[string]interface{}{}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				m[a.Name.Local] = xmlValue(a.Name.Local, a.Value)
+			}
+			if depth == 1 {
+				if t.Name.Local == "senml" {
+					d.report.legacy("<senml> root element")
+					base = m
+				}
+				continue
+			}
+			if t.Name.Local == "e" {
+				d.report.legacy(`"e" array of entries`)
+			}
+			entries = append(entries, m)
+
+		case xml.EndElement:
+			depth -= 1
+		}
+	}
+
+	return d.records(entries, base)
+}
+
+// xmlValue converts an XML attribute to the type the field has in JSON
+func xmlValue(name string, value string) interface{} {
+	switch name {
+	case "bt", "t", "ut", "v", "s", "bver", "ver":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "vb", "bv":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		if f, err := strconv.ParseFloat(value, 64); name == "bv" && err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+func (d lenientDecoder) records(entries []interface{}, base map[string]interface{}) ([]SenMLRecord, error) {
+	var ret []SenMLRecord
+	// a numeric "bv" is the RFC 8428 base value, added to the value of its
+	// record and of the records after it
+	var baseValue float64
+
+	for i, e := range entries {
+		m, ok := d.fields(e)
+		if !ok {
+			return nil, fmt.Errorf("SenML record %d is not a map", i)
+		}
+		if i == 0 {
+			for k, v := range base {
+				if _, set := m[k]; !set {
+					m[k] = v
+				}
+			}
+		}
+		r, err := d.record(m)
+		if err != nil {
+			return nil, fmt.Errorf("SenML record %d: %v", i, err)
+		}
+		if bv, ok := toFloat(m["bv"]); ok {
+			baseValue = bv
+		}
+		if r.Value != nil && baseValue != 0 {
+			v := baseValue + *r.Value
+			r.Value = &v
+		}
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+// fields returns the map of a record keyed by JSON field name
+func (d lenientDecoder) fields(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+
+	case map[interface{}]interface{}:
+		ret := map[string]interface{}{}
+		for k, v := range m {
+			if s, ok := k.(string); ok {
+				if d.format == CBOR {
+					d.report.legacy("text labels in CBOR")
+				}
+				ret[s] = v
+			} else if n, ok := toFloat(k); ok {
+				if name, ok := labels[int(n)]; ok {
+					ret[name] = v
+				}
+			}
+		}
+		return ret, true
+	}
+
+	return nil, false
+}
+
+func (d lenientDecoder) record(m map[string]interface{}) (SenMLRecord, error) {
+	var r SenMLRecord
+
+	// in the order of the names, so the legacy fields are reported the same
+	// way every time
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m[k]
+		name := k
+		if n, ok := legacyNames[k]; ok {
+			if _, set := m[n]; set {
+				continue
+			}
+			if _, ok := v.(bool); k == "bv" && !ok {
+				// a numeric "bv" is the RFC 8428 base value, added to the
+				// values by records
+				continue
+			}
+			d.report.legacy(fmt.Sprintf("%q field", k))
+			name = n
+		}
+
+		ok := true
+		switch name {
+		case "bn":
+			r.BaseName, ok = v.(string)
+		case "bu":
+			r.BaseUnit, ok = v.(string)
+		case "n":
+			r.Name, ok = v.(string)
+		case "u":
+			r.Unit, ok = v.(string)
+		case "l":
+			r.Link, ok = v.(string)
+		case "vs":
+			r.StringValue, ok = v.(string)
+		case "vd":
+			if b, isBytes := v.([]byte); isBytes {
+				r.DataValue = base64.RawURLEncoding.EncodeToString(b)
+			} else {
+				r.DataValue, ok = v.(string)
+			}
+		case "bt":
+			r.BaseTime, ok = d.time(v)
+		case "t":
+			r.Time, ok = d.time(v)
+		case "ut":
+			r.UpdateTime, ok = d.time(v)
+		case "bver":
+			var f float64
+			f, ok = toFloat(v)
+			r.BaseVersion = int(f)
+		case "v":
+			var f float64
+			if f, ok = toFloat(v); ok {
+				r.Value = &f
+			}
+		case "s":
+			var f float64
+			if f, ok = toFloat(v); ok {
+				r.Sum = &f
+			}
+		case "vb":
+			var b bool
+			if b, ok = v.(bool); ok {
+				r.BoolValue = &b
+			}
+		}
+		if !ok {
+			return r, fmt.Errorf("field %q has the wrong type", k)
+		}
+	}
+
+	return r, nil
+}
+
+// time accepts times as numbers, as text holding a number or an RFC 3339
+// date, and as CBOR date/time tags
+func (d lenientDecoder) time(v interface{}) (float64, bool) {
+	if f, ok := toFloat(v); ok {
+		return f, true
+	}
+
+	switch t := v.(type) {
+	case time.Time:
+		d.report.legacy("tagged date/time")
+		return float64(t.UnixNano()) / 1.0e9, true
+
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			d.report.legacy("numeric time as text")
+			return f, true
+		}
+		if tm, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			d.report.legacy("RFC 3339 time")
+			return float64(tm.UnixNano()) / 1.0e9, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,113 @@
+package senml
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLimitExceeded is wrapped by the error returned when a message goes over
+// one of the limits set in DecodeOptions. Test for it with errors.Is.
+var ErrLimitExceeded = errors.New("SenML limit exceeded")
+
+// limits enforces the limits from DecodeOptions as records are decoded
+type limits struct {
+	maxRecords int
+	maxName    int
+	maxValue   int
+
+	records int
+	bname   string
+}
+
+func newLimits(options DecodeOptions) *limits {
+	return &limits{
+		maxRecords: options.MaxRecords,
+		maxName:    options.MaxNameLength,
+		maxValue:   options.MaxValueLength,
+	}
+}
+
+func (l *limits) set() bool {
+	return l.maxRecords > 0 || l.maxName > 0 || l.maxValue > 0
+}
+
+// add checks the next decoded record
+func (l *limits) add(r SenMLRecord) error {
+	l.records += 1
+	if l.maxRecords > 0 && l.records > l.maxRecords {
+		return fmt.Errorf("%w: more than %d records", ErrLimitExceeded, l.maxRecords)
+	}
+
+	if len(r.BaseName) > 0 {
+		l.bname = r.BaseName
+	}
+	if l.maxName > 0 && len(l.bname)+len(r.Name) > l.maxName {
+		return fmt.Errorf("%w: name longer than %d bytes", ErrLimitExceeded, l.maxName)
+	}
+	if l.maxValue > 0 && (len(r.StringValue) > l.maxValue || dataLength(r.DataValue) > l.maxValue) {
+		return fmt.Errorf("%w: value longer than %d bytes", ErrLimitExceeded, l.maxValue)
+	}
+
+	return nil
+}
+
+// dataLength is the number of bytes a base64url data value decodes to
+func dataLength(value string) int {
+	return base64.RawURLEncoding.DecodedLen(len(strings.TrimRight(value, "=")))
+}
+
+func (l *limits) addAll(records []SenMLRecord) error {
+	for _, r := range records {
+		err := l.add(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// items checks a CBOR or MessagePack pack before the codec package decodes
+// it, so that oversized messages are rejected before they are allocated
+func (l *limits) items(pack item) error {
+	if pack.kind != arrayItem {
+		return nil
+	}
+	if l.maxRecords > 0 && len(pack.items) > l.maxRecords {
+		return fmt.Errorf("%w: more than %d records", ErrLimitExceeded, l.maxRecords)
+	}
+
+	for _, r := range pack.items {
+		if r.kind != mapItem {
+			continue
+		}
+		for j := 0; j < len(r.items); j += 2 {
+			value := r.items[j+1]
+			if value.kind != textItem && value.kind != bytesItem {
+				continue
+			}
+
+			name, _ := r.items[j].text()
+			if label, ok := r.items[j].int(); ok {
+				name = labels[int(label)]
+			}
+			switch name {
+			case "n", "bn":
+				if l.maxName > 0 && len(value.b) > l.maxName {
+					return fmt.Errorf("%w: name longer than %d bytes", ErrLimitExceeded, l.maxName)
+				}
+			case "vs", "vd":
+				length := len(value.b)
+				if name == "vd" && value.kind == textItem {
+					length = dataLength(string(value.b))
+				}
+				if l.maxValue > 0 && length > l.maxValue {
+					return fmt.Errorf("%w: value longer than %d bytes", ErrLimitExceeded, l.maxValue)
+				}
+			}
+		}
+	}
+
+	return nil
+}
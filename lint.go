@@ -0,0 +1,145 @@
+package senml
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Problem is something wrong with a record of a pack. Record is the index of
+// the record, or -1 when the problem is with the message as a whole.
+type Problem struct {
+	Record  int    `json:"record"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Warning is set for style problems that do not make the pack invalid
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (p Problem) String() string {
+	var ret string
+	if p.Warning {
+		ret = "warning: "
+	}
+	if p.Record >= 0 {
+		ret += "record " + strconv.Itoa(p.Record) + ": "
+	}
+	return ret + p.Rule + ": " + p.Message
+}
+
+// Validate checks a pack against the rules of RFC 8428 and returns what
+// breaks them, with each record reported once
+func Validate(s SenML) []Problem {
+	var problems []Problem
+	var bname string = ""
+	var bver = -1
+
+	for i, r := range s.Records {
+		report := func(rule string, format string, args ...interface{}) {
+			problems = append(problems, Problem{Record: i, Rule: rule, Message: fmt.Sprintf(format, args...)})
+		}
+
+		// the version must not change
+		if r.BaseVersion != 0 {
+			if bver == -1 {
+				bver = r.BaseVersion
+			} else if r.BaseVersion != bver {
+				report("bver-change", "version changes from %d to %d", bver, r.BaseVersion)
+				continue
+			}
+		}
+
+		if len(r.BaseName) > 0 {
+			bname = r.BaseName
+		}
+		if problem := checkName(bname + r.Name); problem != nil {
+			report(problem.Rule, "%s", problem.Message)
+			continue
+		}
+
+		valueCount := 0
+		for _, kind := range []string{"v", "vs", "vb", "vd"} {
+			if valueKinds[kind](r) {
+				valueCount += 1
+			}
+		}
+		switch {
+		case valueCount > 1:
+			report("value-many", "record has more than one value")
+		case valueCount == 0 && r.Sum == nil:
+			report("value-none", "record has no value or sum")
+		}
+	}
+
+	return problems
+}
+
+// checkName checks the characters of a resolved name
+func checkName(name string) *Problem {
+	if len(name) == 0 {
+		return &Problem{Rule: "name-empty", Message: "record has no name"}
+	}
+	switch name[0] {
+	case '-', ':', '.', '/', '_':
+		return &Problem{Rule: "name-start", Message: fmt.Sprintf("name %q starts with %q", name, name[0])}
+	}
+	for _, l := range name {
+		if (l < 'a' || l > 'z') && (l < 'A' || l > 'Z') && (l < '0' || l > '9') && (l != '-') && (l != ':') && (l != '.') && (l != '/') && (l != '_') {
+			return &Problem{Rule: "name-char", Message: fmt.Sprintf("name %q has the character %q", name, l)}
+		}
+	}
+	return nil
+}
+
+// relativeTimeLimit is 2**28; smaller times are relative to now
+const relativeTimeLimit = 1 << 28
+
+// futureSkew is how far ahead of the clock Lint lets times be
+const futureSkew = time.Minute
+
+// Lint returns warnings for valid packs that are still likely mistakes: a
+// pack with no base name, units in neither registry or that new producers
+// should not use, and absolute times more than a minute ahead of the clock.
+func Lint(s SenML) []Problem {
+	var problems []Problem
+	var bunit string = ""
+	var btime float64 = 0
+
+	if len(s.Records) > 0 && s.Records[0].BaseName == "" {
+		problems = append(problems, Problem{Record: 0, Rule: "bn-missing", Message: "pack has no base name", Warning: true})
+	}
+
+	future := float64(time.Now().Add(futureSkew).Unix())
+	for i, r := range s.Records {
+		report := func(rule string, format string, args ...interface{}) {
+			problems = append(problems, Problem{Record: i, Rule: rule, Message: fmt.Sprintf(format, args...), Warning: true})
+		}
+
+		if len(r.BaseUnit) > 0 {
+			bunit = r.BaseUnit
+		}
+		unit := r.Unit
+		if len(unit) == 0 {
+			unit = bunit
+		}
+		if len(unit) > 0 {
+			u, ok := LookupUnit(unit)
+			switch {
+			case !ok:
+				report("unit-unregistered", "unit %q is not registered", unit)
+			case u.Discouraged:
+				report("unit-discouraged", "unit %q should not be used by new producers", unit)
+			}
+		}
+
+		if r.BaseTime != 0 {
+			btime = r.BaseTime
+		}
+		t := btime + r.Time
+		if t >= relativeTimeLimit && t > future {
+			report("time-future", "time %s is in the future", strconv.FormatFloat(t, 'f', -1, 64))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,98 @@
+package senml_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cisco/senml"
+)
+
+func rules(problems []senml.Problem) string {
+	var ret []string
+	for _, p := range problems {
+		ret = append(ret, p.Rule)
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestValidate(t *testing.T) {
+	v := 1.0
+	yes := true
+	s := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev/", BaseVersion: 10, Name: "ok", Value: &v},
+		{BaseVersion: 11, Name: "ver", Value: &v},
+		{BaseName: "_", Name: "x", Value: &v},
+		{BaseName: "dev/", Name: "sp ace", Value: &v},
+		{Name: "two", Value: &v, BoolValue: &yes},
+		{Name: "none"},
+		{Name: "sum", Sum: &v},
+	}}
+
+	problems := senml.Validate(s)
+	if got := rules(problems); got != "bver-change,name-start,name-char,value-many,value-none" {
+		t.Error("Validate got", got)
+	}
+	if problems[0].Record != 1 || problems[4].Record != 5 {
+		t.Error("Validate record indexes got", problems)
+	}
+	if got := problems[4].String(); got != "record 5: value-none: record has no value or sum" {
+		t.Error("Problem String got", got)
+	}
+	if senml.IsValid(s) {
+		t.Error("IsValid passed a pack with problems")
+	}
+}
+
+func TestDecodeNotValid(t *testing.T) {
+	s, err := senml.Decode([]byte(`[{"n":"a","v":1},{"n":"b"}]`), senml.JSON)
+	if !errors.Is(err, senml.ErrNotValid) {
+		t.Fatal("Decode of a record with no value got", err)
+	}
+	if got := senml.Validate(s); len(got) != 1 || got[0].Record != 1 {
+		t.Error("Validate of the pack returned got", got)
+	}
+}
+
+func TestLint(t *testing.T) {
+	v := 1.0
+	future := float64(time.Now().Add(time.Hour).Unix())
+	s := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseUnit: "Cel", Name: "a", Value: &v, Time: 1600000000},
+		{Name: "b", Unit: "furlong", Value: &v},
+		{Name: "c", Unit: "%", Value: &v},
+		{Name: "d", Unit: "kWh", Value: &v, Time: future},
+		{Name: "e", Value: &v, Time: -10},
+	}}
+
+	problems := senml.Lint(s)
+	if got := rules(problems); got != "bn-missing,unit-unregistered,unit-discouraged,time-future" {
+		t.Error("Lint got", got)
+	}
+	for _, p := range problems {
+		if !p.Warning || !strings.HasPrefix(p.String(), "warning: ") {
+			t.Error("Lint problem is not a warning", p)
+		}
+	}
+
+	s.Records[0].BaseName = "dev/"
+	s.Records[1].Unit = "m"
+	s.Records[2].Unit = "/"
+	s.Records[3].Time = 1600000000
+	if problems := senml.Lint(s); len(problems) != 0 {
+		t.Error("Lint of a clean pack got", problems)
+	}
+}
+
+func TestLookupUnit(t *testing.T) {
+	if u, ok := senml.LookupUnit("Cel"); !ok || u.Discouraged || u.Secondary {
+		t.Error("LookupUnit Cel got", u, ok)
+	}
+	if u, ok := senml.LookupUnit("ms"); !ok || !u.Secondary {
+		t.Error("LookupUnit ms got", u, ok)
+	}
+	if _, ok := senml.LookupUnit("cel"); ok {
+		t.Error("LookupUnit is not case sensitive")
+	}
+}
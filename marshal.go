@@ -0,0 +1,579 @@
+package senml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// The encoders here write the same bytes as encoding/json and the codec
+// package but work straight from the record fields, without reflection, since
+// a server runs every pack it handles through them.
+
+// bufferPool holds the buffers packs are encoded into
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// maxPooledBuffer is the largest buffer put back in the pool, so one huge
+// pack does not pin its buffer for good
+const maxPooledBuffer = 1 << 20
+
+// pooled calls fill with an empty buffer from the pool and returns a copy of
+// what it appended
+func pooled(fill func([]byte) ([]byte, error)) ([]byte, error) {
+	bp := bufferPool.Get().(*[]byte)
+	b, err := fill((*bp)[:0])
+
+	var ret []byte
+	if err == nil && len(b) > 0 {
+		ret = make([]byte, len(b))
+		copy(ret, b)
+	}
+
+	if cap(b) <= maxPooledBuffer {
+		*bp = b
+		bufferPool.Put(bp)
+	}
+	return ret, err
+}
+
+// jsonPlain tells if a record can be written by appendJSONRecord, which
+// leaves the rest to encoding/json: XMLName set and numbers JSON can not hold
+func jsonPlain(r SenMLRecord) bool {
+	finite := func(f float64) bool {
+		return !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	switch {
+	case r.XMLName != nil:
+		return false
+	case !finite(r.BaseTime) || !finite(r.Time) || !finite(r.UpdateTime):
+		return false
+	case r.Value != nil && !finite(*r.Value):
+		return false
+	case r.Sum != nil && !finite(*r.Sum):
+		return false
+	}
+	return true
+}
+
+// appendJSONRecord appends a record as json.Marshal writes it
+func appendJSONRecord(b []byte, r SenMLRecord) ([]byte, error) {
+	if !jsonPlain(r) {
+		data, err := json.Marshal(r)
+		return append(b, data...), err
+	}
+
+	b = append(b, '{')
+	if r.BaseName != "" {
+		b = appendJSONString(appendJSONKey(b, "bn"), r.BaseName)
+	}
+	if r.BaseTime != 0 {
+		b = appendJSONFloat(appendJSONKey(b, "bt"), r.BaseTime)
+	}
+	if r.BaseUnit != "" {
+		b = appendJSONString(appendJSONKey(b, "bu"), r.BaseUnit)
+	}
+	if r.BaseVersion != 0 {
+		b = strconv.AppendInt(appendJSONKey(b, "bver"), int64(r.BaseVersion), 10)
+	}
+	if r.Link != "" {
+		b = appendJSONString(appendJSONKey(b, "l"), r.Link)
+	}
+	if r.Name != "" {
+		b = appendJSONString(appendJSONKey(b, "n"), r.Name)
+	}
+	if r.Unit != "" {
+		b = appendJSONString(appendJSONKey(b, "u"), r.Unit)
+	}
+	if r.Time != 0 {
+		b = appendJSONFloat(appendJSONKey(b, "t"), r.Time)
+	}
+	if r.UpdateTime != 0 {
+		b = appendJSONFloat(appendJSONKey(b, "ut"), r.UpdateTime)
+	}
+	if r.Value != nil {
+		b = appendJSONFloat(appendJSONKey(b, "v"), *r.Value)
+	}
+	if r.StringValue != "" {
+		b = appendJSONString(appendJSONKey(b, "vs"), r.StringValue)
+	}
+	if r.DataValue != "" {
+		b = appendJSONString(appendJSONKey(b, "vd"), r.DataValue)
+	}
+	if r.BoolValue != nil {
+		b = strconv.AppendBool(appendJSONKey(b, "vb"), *r.BoolValue)
+	}
+	if r.Sum != nil {
+		b = appendJSONFloat(appendJSONKey(b, "s"), *r.Sum)
+	}
+	return append(b, '}'), nil
+}
+
+func appendJSONKey(b []byte, key string) []byte {
+	if b[len(b)-1] != '{' {
+		b = append(b, ',')
+	}
+	b = append(b, '"')
+	b = append(b, key...)
+	return append(b, '"', ':')
+}
+
+// appendJSONString quotes plain ASCII itself and leaves strings needing
+// escapes to encoding/json
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			data, _ := json.Marshal(s)
+			return append(b, data...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// appendJSONFloat formats a number like encoding/json: plain decimals, with
+// exponents only for very small and very large magnitudes
+func appendJSONFloat(b []byte, f float64) []byte {
+	var format byte = 'f'
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// appendJSONRecords appends records as a JSON array, one per line when
+// pretty is set
+func appendJSONRecords(b []byte, records []SenMLRecord, pretty bool) ([]byte, error) {
+	start, sep, end := "[", ",", "]"
+	if pretty {
+		start, sep, end = "[\n  ", ",\n  ", "\n]\n"
+	}
+
+	var err error
+	b = append(b, start...)
+	for i, r := range records {
+		if i != 0 {
+			b = append(b, sep...)
+		}
+		b, err = appendJSONRecord(b, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(b, end...), nil
+}
+
+// appendJSONLines appends records as JSON lines
+func appendJSONLines(b []byte, records []SenMLRecord) ([]byte, error) {
+	var err error
+	for _, r := range records {
+		b, err = appendJSONRecord(b, r)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
+// appendCSV appends the CSV rows of the records with values, as Encode
+// passes them to writeCSV when they are not aligned
+func appendCSV(b []byte, records []SenMLRecord) []byte {
+	for _, r := range records {
+		if r.Value == nil {
+			continue
+		}
+		b = append(b, r.Name...)
+		b = append(b, ',')
+		b = strconv.AppendFloat(b, (r.Time/(24.0*3600.0))+25569.0, 'f', 6, 64)
+		b = append(b, ',')
+		b = strconv.AppendFloat(b, *r.Value, 'f', 6, 64)
+		if len(r.Unit) > 0 {
+			b = append(b, ',')
+			b = append(b, r.Unit...)
+		}
+		b = append(b, '\r', '\n')
+	}
+	return b
+}
+
+// CBOR major types
+const (
+	cborUint  = 0
+	cborNeg   = 1
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborOther = 7
+)
+
+func appendCBORInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendCBORHead(b, cborNeg, uint64(-1-v), 0)
+	}
+	return appendCBORHead(b, cborUint, uint64(v), 0)
+}
+
+func appendCBORText(b []byte, s string) []byte {
+	b = appendCBORHead(b, cborText, uint64(len(s)), 0)
+	return append(b, s...)
+}
+
+// appendCBORFloat writes all eight bytes as the codec package does
+func appendCBORFloat(b []byte, f float64) []byte {
+	return appendCBORHead(b, cborOther, math.Float64bits(f), 8)
+}
+
+// appendCBORShortest writes a float in the fewest bytes that hold it
+// exactly, with NaN as the half precision quiet NaN
+func appendCBORShortest(b []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(b, 0xf9, 0x7e, 0x00)
+	case halfToFloat(floatToHalf(f)) == f:
+		return appendCBORHead(b, cborOther, uint64(floatToHalf(f)), 2)
+	case float64(float32(f)) == f:
+		return appendCBORHead(b, cborOther, uint64(math.Float32bits(float32(f))), 4)
+	}
+	return appendCBORFloat(b, f)
+}
+
+func appendCBORBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+// cborOptions is how appendCBORRecords writes a pack
+type cborOptions struct {
+	canonical bool
+	float32   bool
+}
+
+// cborLabels are the labels of RFC 8428 in the order the codec package
+// sorts them, and canonicalLabels in the order of their encoded bytes
+var (
+	cborLabels      = []int{-4, -3, -2, -1, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+	canonicalLabels = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, -1, -2, -3, -4}
+)
+
+// cborFieldSet tells if a record has the field with a label. Like the map
+// the codec package was given before, fields are left out when they hold the
+// zero value of their type, so a time of -0 is kept.
+func cborFieldSet(r SenMLRecord, label int) bool {
+	switch label {
+	case -1:
+		return r.BaseVersion != 0
+	case -2:
+		return r.BaseName != ""
+	case -3:
+		return math.Float64bits(r.BaseTime) != 0
+	case -4:
+		return r.BaseUnit != ""
+	case 0:
+		return r.Name != ""
+	case 1:
+		return r.Unit != ""
+	case 2:
+		return r.Value != nil
+	case 3:
+		return r.StringValue != ""
+	case 4:
+		return r.BoolValue != nil
+	case 5:
+		return r.Sum != nil
+	case 6:
+		return math.Float64bits(r.Time) != 0
+	case 7:
+		return math.Float64bits(r.UpdateTime) != 0
+	case 8:
+		return r.DataValue != ""
+	}
+	return false
+}
+
+// appendCBORNumber writes a float as options ask, with value set for values
+// and sums, which may be written in single precision
+func appendCBORNumber(b []byte, f float64, value bool, options cborOptions) []byte {
+	if value && options.float32 {
+		f = float64(float32(f))
+	}
+	switch {
+	case options.canonical:
+		return appendCBORShortest(b, f)
+	case value && options.float32:
+		return appendCBORHead(b, cborOther, uint64(math.Float32bits(float32(f))), 4)
+	}
+	return appendCBORFloat(b, f)
+}
+
+// appendCBORRecord appends a record as a CBOR map with the labels of RFC 8428
+func appendCBORRecord(b []byte, r SenMLRecord, options cborOptions) []byte {
+	order := cborLabels
+	if options.canonical {
+		order = canonicalLabels
+	}
+
+	n := 0
+	for _, label := range order {
+		if cborFieldSet(r, label) {
+			n += 1
+		}
+	}
+	b = appendCBORHead(b, cborMap, uint64(n), 0)
+
+	for _, label := range order {
+		if !cborFieldSet(r, label) {
+			continue
+		}
+		b = appendCBORInt(b, int64(label))
+		switch label {
+		case -1:
+			b = appendCBORInt(b, int64(r.BaseVersion))
+		case -2:
+			b = appendCBORText(b, r.BaseName)
+		case -3:
+			b = appendCBORNumber(b, r.BaseTime, false, options)
+		case -4:
+			b = appendCBORText(b, r.BaseUnit)
+		case 0:
+			b = appendCBORText(b, r.Name)
+		case 1:
+			b = appendCBORText(b, r.Unit)
+		case 2:
+			b = appendCBORNumber(b, *r.Value, true, options)
+		case 3:
+			b = appendCBORText(b, r.StringValue)
+		case 4:
+			b = appendCBORBool(b, *r.BoolValue)
+		case 5:
+			b = appendCBORNumber(b, *r.Sum, true, options)
+		case 6:
+			b = appendCBORNumber(b, r.Time, false, options)
+		case 7:
+			b = appendCBORNumber(b, r.UpdateTime, false, options)
+		case 8:
+			b = appendCBORText(b, r.DataValue)
+		}
+	}
+	return b
+}
+
+// appendCBORRecords appends records as a CBOR array, or null when there are
+// none as the codec package wrote the nil slice it was given then
+func appendCBORRecords(b []byte, records []SenMLRecord, options cborOptions) []byte {
+	if len(records) == 0 {
+		return append(b, 0xf6)
+	}
+	b = appendCBORHead(b, cborArray, uint64(len(records)), 0)
+	for _, r := range records {
+		b = appendCBORRecord(b, r, options)
+	}
+	return b
+}
+
+// cborReader reads the parts of a pack decodeCBORRecords understands
+type cborReader struct {
+	data []byte
+	pos  int
+	// strings holds the text read so far, since names and units repeat from
+	// record to record
+	strings map[string]string
+}
+
+// head reads the start of a data item, returning its major type and argument.
+// Indefinite lengths are not accepted.
+func (d *cborReader) head() (byte, uint64, bool) {
+	if d.pos >= len(d.data) {
+		return 0, 0, false
+	}
+	major := d.data[d.pos] >> 5
+	info := d.data[d.pos] & 0x1f
+	arg, n, err := readCBORArg(d.data[d.pos+1:], info)
+	if err != nil || info == 31 {
+		return 0, 0, false
+	}
+	d.pos += 1 + n
+	return major, arg, true
+}
+
+func (d *cborReader) bytes(n uint64) ([]byte, bool) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, false
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, true
+}
+
+func (d *cborReader) int() (int64, bool) {
+	major, arg, ok := d.head()
+	switch {
+	case !ok || arg > math.MaxInt64:
+		return 0, false
+	case major == cborUint:
+		return int64(arg), true
+	case major == cborNeg:
+		return -1 - int64(arg), true
+	}
+	return 0, false
+}
+
+func (d *cborReader) number() (float64, bool) {
+	start := d.pos
+	major, arg, ok := d.head()
+	switch {
+	case !ok:
+		return 0, false
+	case major == cborUint:
+		return float64(arg), true
+	case major == cborNeg && arg <= math.MaxInt64:
+		return float64(-1 - int64(arg)), true
+	case major != cborOther:
+		return 0, false
+	}
+	switch d.data[start] & 0x1f {
+	case 25:
+		return halfToFloat(uint16(arg)), true
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), true
+	case 27:
+		return math.Float64frombits(arg), true
+	}
+	return 0, false
+}
+
+func (d *cborReader) text() (string, bool) {
+	major, arg, ok := d.head()
+	if !ok || major != cborText {
+		return "", false
+	}
+	b, ok := d.bytes(arg)
+	if s, found := d.strings[string(b)]; found {
+		return s, ok
+	}
+	s := string(b)
+	d.strings[s] = s
+	return s, ok
+}
+
+// minRecordBytes is the size of the smallest CBOR record holding a field, a
+// map head, a label and a one byte value
+const minRecordBytes = 3
+
+// decodeCBORRecords reads a pack straight into records when it is an array
+// of maps with integer labels and values of the types RFC 8428 gives them,
+// as any encoder writes it. It returns false for anything else, such as
+// nulls, tags or indefinite lengths, which is left to the codec package.
+func decodeCBORRecords(msg []byte) ([]SenMLRecord, bool) {
+	d := cborReader{data: msg, strings: map[string]string{}}
+	major, count, ok := d.head()
+	// the records are allocated before they are read, so the count can not
+	// be more than the rest of the message could hold
+	if !ok || major != cborArray || count > uint64(len(msg)-d.pos)/minRecordBytes {
+		return nil, false
+	}
+	if count == 0 {
+		return nil, true
+	}
+
+	records := make([]SenMLRecord, count)
+	// the values and sums are kept together rather than one at a time
+	numbers := make([]float64, 2*count)
+	var bools []bool
+	for i := range records {
+		r := &records[i]
+		major, fields, ok := d.head()
+		if !ok || major != cborMap {
+			return nil, false
+		}
+		for j := uint64(0); j < fields && ok; j++ {
+			var label int64
+			label, ok = d.int()
+			if !ok {
+				return nil, false
+			}
+
+			switch label {
+			case -1:
+				var v float64
+				v, ok = d.number()
+				r.BaseVersion = int(v)
+			case -2:
+				r.BaseName, ok = d.text()
+			case -3:
+				r.BaseTime, ok = d.number()
+			case -4:
+				r.BaseUnit, ok = d.text()
+			case 0:
+				r.Name, ok = d.text()
+			case 1:
+				r.Unit, ok = d.text()
+			case 2:
+				numbers[2*i], ok = d.number()
+				r.Value = &numbers[2*i]
+			case 3:
+				r.StringValue, ok = d.text()
+			case 4:
+				if d.pos >= len(msg) || msg[d.pos] != 0xf4 && msg[d.pos] != 0xf5 {
+					return nil, false
+				}
+				if bools == nil {
+					bools = make([]bool, count)
+				}
+				bools[i] = msg[d.pos] == 0xf5
+				r.BoolValue = &bools[i]
+				d.pos += 1
+			case 5:
+				numbers[2*i+1], ok = d.number()
+				r.Sum = &numbers[2*i+1]
+			case 6:
+				r.Time, ok = d.number()
+			case 7:
+				r.UpdateTime, ok = d.number()
+			case 8:
+				var major byte
+				var n uint64
+				var b []byte
+				major, n, ok = d.head()
+				if ok {
+					b, ok = d.bytes(n)
+				}
+				switch {
+				case major == cborText:
+					r.DataValue = string(b)
+				case major == cborBytes:
+					r.DataValue = base64.RawURLEncoding.EncodeToString(b)
+				default:
+					ok = false
+				}
+			default:
+				ok = false
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return records, true
+}
@@ -0,0 +1,212 @@
+package senml_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/cisco/senml"
+	"github.com/ugorji/go/codec"
+)
+
+// randomRecords makes records with a random mix of fields, with strings and
+// numbers picked to need escapes, exponents and every CBOR length
+func randomRecords(rnd *rand.Rand, n int) []senml.SenMLRecord {
+	texts := []string{"", "a", "dev/temp", "urn:dev:ow:10e2073a01080063", "<&>", "quote\"back\\slash", "tab\t", "é", " ", string(make([]byte, 30)), "x" + string(bytes.Repeat([]byte("y"), 300))}
+	numbers := []float64{0, math.Copysign(0, -1), 1, -1, 0.5, 23.1, 1.5e9, 1e-7, 1e21, -3e-10, 1e100, math.MaxFloat64, math.SmallestNonzeroFloat64, 255, 65536}
+	ints := []int{0, 10, -1, 23, 24, 255, 256, 70000, -70000}
+
+	text := func() string { return texts[rnd.Intn(len(texts))] }
+	number := func() float64 { return numbers[rnd.Intn(len(numbers))] }
+	maybe := func() bool { return rnd.Intn(2) == 0 }
+
+	records := make([]senml.SenMLRecord, n)
+	for i := range records {
+		r := &records[i]
+		if maybe() {
+			r.BaseName, r.BaseUnit, r.BaseTime, r.BaseVersion = text(), text(), number(), ints[rnd.Intn(len(ints))]
+		}
+		r.Name, r.Unit, r.Time = text(), text(), number()
+		if maybe() {
+			r.UpdateTime = number()
+		}
+		switch rnd.Intn(4) {
+		case 0:
+			v := number()
+			r.Value = &v
+		case 1:
+			r.StringValue = text()
+		case 2:
+			b := maybe()
+			r.BoolValue = &b
+		case 3:
+			r.DataValue = text()
+		}
+		if maybe() {
+			sum := number()
+			r.Sum = &sum
+		}
+	}
+	return records
+}
+
+// cborRecords builds the maps the codec package encoded before Encode wrote
+// CBOR itself
+func cborRecords(records []senml.SenMLRecord) []map[int]interface{} {
+	var ret []map[int]interface{}
+	for _, r := range records {
+		m := map[int]interface{}{}
+		set := func(label int, v interface{}, ok bool) {
+			if ok {
+				m[label] = v
+			}
+		}
+		set(-1, r.BaseVersion, r.BaseVersion != 0)
+		set(-2, r.BaseName, r.BaseName != "")
+		set(-3, r.BaseTime, math.Float64bits(r.BaseTime) != 0)
+		set(-4, r.BaseUnit, r.BaseUnit != "")
+		set(0, r.Name, r.Name != "")
+		set(1, r.Unit, r.Unit != "")
+		set(2, r.Value, r.Value != nil)
+		set(3, r.StringValue, r.StringValue != "")
+		set(4, r.BoolValue, r.BoolValue != nil)
+		set(5, r.Sum, r.Sum != nil)
+		set(6, r.Time, math.Float64bits(r.Time) != 0)
+		set(7, r.UpdateTime, math.Float64bits(r.UpdateTime) != 0)
+		set(8, r.DataValue, r.DataValue != "")
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func TestEncodeMatchesLibraries(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 200; i++ {
+		s := senml.SenML{Records: randomRecords(rnd, rnd.Intn(20))}
+
+		data, err := senml.Encode(s, senml.JSON, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.Marshal(s.Records)
+		if !bytes.Equal(data, want) {
+			t.Fatalf("JSON\n got %s\nwant %s", data, want)
+		}
+
+		data, err = senml.Encode(s, senml.JSONLINE, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = nil
+		for _, r := range s.Records {
+			line, _ := json.Marshal(r)
+			want = append(append(want, line...), '\n')
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("JSONLINE\n got %s\nwant %s", data, want)
+		}
+
+		data, err = senml.Encode(s, senml.CBOR, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = nil
+		handle := &codec.CborHandle{}
+		handle.Canonical = true
+		err = codec.NewEncoderBytes(&want, handle).Encode(cborRecords(s.Records))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("CBOR\n got %x\nwant %x", data, want)
+		}
+	}
+}
+
+func TestEncodeEscapes(t *testing.T) {
+	v := math.Inf(1)
+	_, err := senml.Encode(senml.SenML{Records: []senml.SenMLRecord{{Name: "a", Value: &v}}}, senml.JSON, senml.OutputOptions{})
+	if err == nil {
+		t.Error("infinite value encoded as JSON")
+	}
+
+	data, err := senml.Encode(senml.SenML{}, senml.JSON, senml.OutputOptions{})
+	if err != nil || string(data) != "null" {
+		t.Errorf("empty pack gives %s, %v", data, err)
+	}
+}
+
+func TestDecodeCBORMatchesCodec(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 200; i++ {
+		records := randomRecords(rnd, 1+rnd.Intn(20))
+
+		// labels in any order and numbers as integers
+		// and short floats, as other encoders may send them
+		var msg []byte
+		enc := codec.NewEncoderBytes(&msg, &codec.CborHandle{})
+		maps := cborRecords(records)
+		for _, m := range maps {
+			if v, ok := m[6].(float64); ok && v == math.Trunc(v) && math.Abs(v) < 1e15 {
+				m[6] = int64(v)
+			}
+			if v, ok := m[-3].(float64); ok && float64(float32(v)) == v {
+				m[-3] = float32(v)
+			}
+			if v, ok := m[8].(string); ok && rnd.Intn(2) == 0 {
+				m[8] = []byte(v)
+			}
+		}
+		err := enc.Encode(maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := senml.Decode(msg, senml.CBOR)
+		if err != nil && !errors.Is(err, senml.ErrNotValid) {
+			t.Fatal(err)
+		}
+
+		// what the codec package makes of it with a null in the last record,
+		// which Decode leaves to it
+		maps[len(maps)-1][7] = nil
+		var withNull []byte
+		err = codec.NewEncoderBytes(&withNull, &codec.CborHandle{}).Encode(maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := senml.Decode(withNull, senml.CBOR)
+		if err != nil && !errors.Is(err, senml.ErrNotValid) {
+			t.Fatal(err)
+		}
+		want.Records[len(want.Records)-1].UpdateTime = got.Records[len(got.Records)-1].UpdateTime
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("CBOR decode\n got %+v\nwant %+v", got.Records, want.Records)
+		}
+	}
+}
+
+func TestDecodeCBORHugeCount(t *testing.T) {
+	// an array head claiming a million records, followed by a megabyte that
+	// holds none
+	msg := append([]byte{0x9a, 0x00, 0x0f, 0x42, 0x40}, bytes.Repeat([]byte{0xff}, 1<<20)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := senml.Decode(msg, senml.CBOR)
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Error("huge count decoded")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("huge count allocated %d bytes", allocated)
+	}
+}
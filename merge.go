@@ -0,0 +1,103 @@
+package senml
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Merge resolves the base fields of each pack and returns all their records
+// in one pack, sorted by time and then by name. The highest version set by
+// any of the packs is put on the first record.
+func Merge(packs ...SenML) SenML {
+	var ret SenML
+	ret.XMLName = nil
+	ret.Xmlns = "urn:ietf:params:xml:ns:senml"
+
+	for _, s := range packs {
+		ret.Records = append(ret.Records, resolve(s).Records...)
+	}
+	sort.SliceStable(ret.Records, func(i, j int) bool {
+		a, b := ret.Records[i], ret.Records[j]
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.Name < b.Name
+	})
+	if version := clearVersions(ret.Records); version != 0 {
+		ret.Records[0].BaseVersion = version
+	}
+
+	return ret
+}
+
+// clearVersions removes bver from the records and returns the highest seen
+func clearVersions(records []SenMLRecord) int {
+	version := 0
+	for i := range records {
+		if records[i].BaseVersion > version {
+			version = records[i].BaseVersion
+		}
+		records[i].BaseVersion = 0
+	}
+	return version
+}
+
+// shortestOffset returns the time t as an offset from base with the fewest
+// decimal digits that still adds back up to t, so only digits that come from
+// printing the binary fraction are trimmed
+func shortestOffset(t float64, base float64) float64 {
+	exact := t - base
+	for digits := 0; digits < 17; digits++ {
+		scale := math.Pow10(digits)
+		offset := math.Round(exact*scale) / scale
+		if base+offset == t {
+			return offset
+		}
+	}
+	return exact
+}
+
+// Compact is the opposite of Normalize. It moves the common start of the
+// names, the first time and a unit shared by every record into base fields
+// on the first record. The base name stops after the last '/', ':' or '.'
+// so no record is left without a name.
+func Compact(s SenML) SenML {
+	ret := resolve(s)
+	if len(ret.Records) == 0 {
+		return ret
+	}
+	records := ret.Records
+
+	prefix := records[0].Name
+	unit := records[0].Unit
+	for _, r := range records[1:] {
+		for !strings.HasPrefix(r.Name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+		if r.Unit != unit {
+			unit = ""
+		}
+	}
+	prefix = prefix[:strings.LastIndexAny(prefix, "/:.")+1]
+
+	baseTime := records[0].Time
+	for i := range records {
+		r := &records[i]
+		r.Name = r.Name[len(prefix):]
+		r.Time = shortestOffset(r.Time, baseTime)
+		if unit != "" {
+			r.Unit = ""
+		}
+	}
+	version := clearVersions(records)
+	records[0].BaseName = prefix
+	records[0].BaseTime = baseTime
+	records[0].BaseUnit = unit
+	if version != 10 {
+		// 10 is the default version in RFC 8428
+		records[0].BaseVersion = version
+	}
+
+	return ret
+}
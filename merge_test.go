@@ -0,0 +1,110 @@
+package senml_test
+
+import (
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestMerge(t *testing.T) {
+	a := 1.0
+	b := 2.0
+	packA := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev1/", BaseTime: 1600000000, Name: "temp", Value: &a, Time: 20},
+		{Name: "temp", Value: &b, Time: 0},
+	}}
+	packB := senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev2/", Name: "temp", Value: &a, Time: 1600000010},
+		{BaseName: "dev0/", Name: "temp", Value: &b, Time: 1600000020},
+	}}
+
+	s := senml.Merge(packA, packB)
+	if got := names(s); got != "dev1/temp,dev2/temp,dev0/temp,dev1/temp" {
+		t.Error("Merge order got", got)
+	}
+	if s.Records[2].Time != 1600000020 || s.Records[3].Time != 1600000020 {
+		t.Error("Merge times got", s.Records)
+	}
+	if !senml.IsValid(s) {
+		t.Error("Merge result is not valid")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := senml.Compact(pipelinePack())
+	r := s.Records
+	if r[0].BaseName != "room1/" || r[0].BaseTime != 1600000000 || r[0].Name != "temp" || r[1].Time != 10 {
+		t.Error("Compact got", r)
+	}
+	if r[0].BaseUnit != "" || r[0].Unit != "Cel" {
+		t.Error("Compact of mixed units got", r[0])
+	}
+
+	back := senml.Normalize(s)
+	want := senml.Normalize(pipelinePack())
+	for i := range want.Records {
+		if back.Records[i].Name != want.Records[i].Name || back.Records[i].Time != want.Records[i].Time {
+			t.Error("Compact does not resolve back, got", back.Records[i])
+		}
+	}
+
+	v := 1.0
+	same := senml.SenML{Records: []senml.SenMLRecord{
+		{Name: "urn:dev:a", Unit: "V", Value: &v, Time: 1600000000.25},
+		{Name: "urn:dev:b", Unit: "V", Value: &v, Time: 1600000001.5},
+	}}
+	r = senml.Compact(same).Records
+	if r[0].BaseName != "urn:dev:" || r[0].BaseUnit != "V" || r[1].Unit != "" || r[1].Time != 1.25 {
+		t.Error("Compact of shared unit got", r)
+	}
+}
+
+func TestMergeVersions(t *testing.T) {
+	v := 1.0
+	plain := senml.SenML{Records: []senml.SenMLRecord{{Name: "a", Value: &v, Time: 1600000000}}}
+	versioned := senml.SenML{Records: []senml.SenMLRecord{{BaseVersion: 13, Name: "b", Value: &v, Time: 1600000001}}}
+
+	s := senml.Merge(plain, plain)
+	for _, r := range s.Records {
+		if r.BaseVersion != 0 {
+			t.Error("Merge added a version", r)
+		}
+	}
+
+	s = senml.Merge(plain, versioned)
+	if s.Records[0].BaseVersion != 13 || s.Records[1].BaseVersion != 0 {
+		t.Error("Merge of versions got", s.Records)
+	}
+	if !senml.IsValid(s) {
+		t.Error("Merge of versions is not valid")
+	}
+
+	data, err := senml.Encode(senml.Compact(plain), senml.JSON, senml.OutputOptions{})
+	if err != nil || string(data) != `[{"bt":1600000000,"n":"a","v":1}]` {
+		t.Errorf("Compact got %s, %v", data, err)
+	}
+}
+
+func TestCompactSumOnly(t *testing.T) {
+	sum := 5.0
+	s := senml.Compact(senml.SenML{Records: []senml.SenMLRecord{{Name: "s", Sum: &sum, Time: 1600000000}}})
+	if len(s.Records) != 1 || s.Records[0].Sum == nil || *s.Records[0].Sum != 5 {
+		t.Error("Compact of a sum got", s.Records)
+	}
+}
+
+func TestCompactFineTimes(t *testing.T) {
+	v := 1.0
+	times := []float64{1600000000.25, 1600000000.2500005, 1600000000.2500007}
+	var s senml.SenML
+	for _, tm := range times {
+		s.Records = append(s.Records, senml.SenMLRecord{Name: "a", Value: &v, Time: tm})
+	}
+
+	back := senml.Normalize(senml.Compact(s)).Records
+	for i, tm := range times {
+		if back[i].Time != tm {
+			t.Errorf("Compact changed time %v to %v", tm, back[i].Time)
+		}
+	}
+}
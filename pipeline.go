@@ -0,0 +1,403 @@
+package senml
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Transform is one stage of a Pipeline
+type Transform interface {
+	Apply(s SenML) (SenML, error)
+}
+
+// Pipeline applies its stages in order. The pack is normalized first so each
+// stage sees records with resolved names, units and absolute times.
+type Pipeline []Transform
+
+func (p Pipeline) Apply(s SenML) (SenML, error) {
+	var err error
+
+	s = Normalize(s)
+	for _, t := range p {
+		s, err = t.Apply(s)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// RecordFunc is a Transform that works on one record at a time. It returns
+// the record to keep, or false to drop it.
+type RecordFunc func(r SenMLRecord) (SenMLRecord, bool, error)
+
+func (f RecordFunc) Apply(s SenML) (SenML, error) {
+	var ret SenML
+	ret.XMLName = s.XMLName
+	ret.Xmlns = s.Xmlns
+
+	for _, r := range s.Records {
+		r, keep, err := f(r)
+		if err != nil {
+			return ret, err
+		}
+		if keep {
+			ret.Records = append(ret.Records, r)
+		}
+	}
+
+	return ret, nil
+}
+
+// FilterName keeps the records whose name matches a glob pattern as used by
+// path.Match, so "room1/*" matches every name directly under "room1/".
+func FilterName(pattern string) (Transform, error) {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad name pattern %q: %v", pattern, err)
+	}
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		match, _ := path.Match(pattern, r.Name)
+		return r, match, nil
+	}), nil
+}
+
+// FilterNameRegexp keeps the records whose name matches a regular expression
+func FilterNameRegexp(expr string) (Transform, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		return r, re.MatchString(r.Name), nil
+	}), nil
+}
+
+// FilterTime keeps the records with start <= t < end
+func FilterTime(start float64, end float64) Transform {
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		return r, r.Time >= start && r.Time < end, nil
+	})
+}
+
+// valueKinds maps the value field names to a test for the field
+var valueKinds = map[string]func(r SenMLRecord) bool{
+	"v":  func(r SenMLRecord) bool { return r.Value != nil },
+	"vs": func(r SenMLRecord) bool { return r.StringValue != "" },
+	"vb": func(r SenMLRecord) bool { return r.BoolValue != nil },
+	"vd": func(r SenMLRecord) bool { return r.DataValue != "" },
+	"s":  func(r SenMLRecord) bool { return r.Sum != nil },
+}
+
+// FilterKind keeps the records that carry any of the given value fields,
+// named "v", "vs", "vb", "vd" or "s".
+func FilterKind(kinds ...string) (Transform, error) {
+	var tests []func(r SenMLRecord) bool
+	for _, kind := range kinds {
+		test, ok := valueKinds[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown value kind %q", kind)
+		}
+		tests = append(tests, test)
+	}
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		for _, test := range tests {
+			if test(r) {
+				return r, true, nil
+			}
+		}
+		return r, false, nil
+	}), nil
+}
+
+// Rename changes the name from to the name to. A from ending in "*" renames
+// every name with that prefix, replacing the prefix with to.
+func Rename(from string, to string) Transform {
+	prefix := strings.HasSuffix(from, "*")
+	from = strings.TrimSuffix(from, "*")
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		switch {
+		case prefix && strings.HasPrefix(r.Name, from):
+			r.Name = to + r.Name[len(from):]
+		case !prefix && r.Name == from:
+			r.Name = to
+		}
+		return r, true, nil
+	})
+}
+
+// Scale sets the value and sum of the records whose name matches a glob
+// pattern to value*factor + offset, for unit conversions such as Celsius to
+// Fahrenheit.
+func Scale(pattern string, factor float64, offset float64) (Transform, error) {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad name pattern %q: %v", pattern, err)
+	}
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		if match, _ := path.Match(pattern, r.Name); !match {
+			return r, true, nil
+		}
+		if r.Value != nil {
+			v := *r.Value*factor + offset
+			r.Value = &v
+		}
+		if r.Sum != nil {
+			s := *r.Sum*factor + offset
+			r.Sum = &s
+		}
+		return r, true, nil
+	}), nil
+}
+
+// droppable maps the fields DropFields can remove to a function clearing them
+var droppable = map[string]func(r *SenMLRecord){
+	"u":  func(r *SenMLRecord) { r.Unit = "" },
+	"t":  func(r *SenMLRecord) { r.Time = 0 },
+	"ut": func(r *SenMLRecord) { r.UpdateTime = 0 },
+	"l":  func(r *SenMLRecord) { r.Link = "" },
+	"s":  func(r *SenMLRecord) { r.Sum = nil },
+	"v":  func(r *SenMLRecord) { r.Value = nil },
+	"vs": func(r *SenMLRecord) { r.StringValue = "" },
+	"vb": func(r *SenMLRecord) { r.BoolValue = nil },
+	"vd": func(r *SenMLRecord) { r.DataValue = "" },
+}
+
+// DropFields removes the named fields from every record. Records left with
+// no value or sum are dropped too.
+func DropFields(fields ...string) (Transform, error) {
+	var clear []func(r *SenMLRecord)
+	for _, field := range fields {
+		f, ok := droppable[field]
+		if !ok {
+			return nil, fmt.Errorf("field %q can not be dropped", field)
+		}
+		clear = append(clear, f)
+	}
+
+	return RecordFunc(func(r SenMLRecord) (SenMLRecord, bool, error) {
+		for _, f := range clear {
+			f(&r)
+		}
+		keep := false
+		for _, test := range valueKinds {
+			keep = keep || test(r)
+		}
+		return r, keep, nil
+	}), nil
+}
+
+// ParsePipeline reads a pipeline with one stage per line or separated by
+// semicolons. Text after a # is a comment. An argument holding spaces, # or
+// ; is written as a Go quoted string, such as regexp "^a;b". The stages are:
+//
+//	name <glob>                 keep records with matching names
+//	regexp <expression>         keep records with matching names
+//	time <start> <end>          keep records in the time window, - for open
+//	kind <field>...             keep records with any of v, vs, vb, vd or s
+//	rename <from> <to>          rename records, from may end in *
+//	scale <glob> <factor> [<offset>]
+//	drop <field>...             remove fields from the records
+//	where <expression>          keep records passing a filter expression
+//
+// See CompileFilter for the filter expressions.
+func ParsePipeline(spec string) (Pipeline, error) {
+	var p Pipeline
+
+	lines := bufio.NewScanner(strings.NewReader(spec))
+	lineNum := 0
+	for lines.Scan() {
+		lineNum += 1
+		stages, err := splitStages(lines.Text())
+		if err != nil {
+			return nil, fmt.Errorf("pipeline line %d: %v", lineNum, err)
+		}
+		for _, stage := range stages {
+			words, err := splitWords(stage)
+			if err != nil {
+				return nil, fmt.Errorf("pipeline line %d: %v", lineNum, err)
+			}
+			if len(words) == 0 {
+				continue
+			}
+			var t Transform
+			if words[0] == "where" {
+				expr := strings.TrimSpace(stage)[len("where"):]
+				t, err = CompileFilter(strings.TrimSpace(expr))
+			} else {
+				t, err = parseStage(words[0], words[1:])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("pipeline line %d: %v", lineNum, err)
+			}
+			p = append(p, t)
+		}
+	}
+
+	return p, lines.Err()
+}
+
+// quotedEnd returns the index just past the quoted string starting at
+// line[start], or -1 when it is not terminated
+func quotedEnd(line string, start int) int {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i += 1
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// splitStages splits a line at the semicolons and drops any comment, leaving
+// quoted strings whole
+func splitStages(line string) ([]string, error) {
+	var stages []string
+
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			end := quotedEnd(line, i)
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			i = end - 1
+		case ';':
+			stages = append(stages, line[start:i])
+			start = i + 1
+		case '#':
+			return append(stages, line[start:i]), nil
+		}
+	}
+
+	return append(stages, line[start:]), nil
+}
+
+// splitWords splits a stage at spaces outside quoted strings, unquoting the
+// words that are quoted strings
+func splitWords(stage string) ([]string, error) {
+	var words []string
+
+	i := 0
+	for i < len(stage) {
+		if stage[i] == ' ' || stage[i] == '\t' {
+			i += 1
+			continue
+		}
+		start := i
+		for i < len(stage) && stage[i] != ' ' && stage[i] != '\t' {
+			if stage[i] == '"' {
+				end := quotedEnd(stage, i)
+				if end < 0 {
+					return nil, errors.New("unterminated string")
+				}
+				i = end
+				continue
+			}
+			i += 1
+		}
+		word := stage[start:i]
+		if word[0] == '"' && quotedEnd(word, 0) == len(word) {
+			var err error
+			word, err = strconv.Unquote(word)
+			if err != nil {
+				return nil, err
+			}
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// ReadPipelineFile reads a pipeline from a file in the form ParsePipeline
+// takes
+func ReadPipelineFile(name string) (Pipeline, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePipeline(string(data))
+}
+
+func parseStage(op string, args []string) (Transform, error) {
+	want := map[string]int{"name": 1, "regexp": 1, "time": 2, "rename": 2}
+	if n, ok := want[op]; ok && len(args) != n {
+		return nil, fmt.Errorf("%s takes %d arguments", op, n)
+	}
+
+	switch op {
+	case "name":
+		return FilterName(args[0])
+
+	case "regexp":
+		return FilterNameRegexp(args[0])
+
+	case "time":
+		start, err := parseBound(args[0], math.Inf(-1))
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseBound(args[1], math.Inf(1))
+		if err != nil {
+			return nil, err
+		}
+		return FilterTime(start, end), nil
+
+	case "kind":
+		if len(args) == 0 {
+			return nil, errors.New("kind takes at least one field")
+		}
+		return FilterKind(args...)
+
+	case "rename":
+		return Rename(args[0], args[1]), nil
+
+	case "scale":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, errors.New("scale takes a pattern, a factor and an optional offset")
+		}
+		factor, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		offset := 0.0
+		if len(args) == 3 {
+			offset, err = strconv.ParseFloat(args[2], 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return Scale(args[0], factor, offset)
+
+	case "drop":
+		if len(args) == 0 {
+			return nil, errors.New("drop takes at least one field")
+		}
+		return DropFields(args...)
+	}
+
+	return nil, fmt.Errorf("unknown pipeline stage %q", op)
+}
+
+func parseBound(arg string, open float64) (float64, error) {
+	if arg == "-" {
+		return open, nil
+	}
+	return strconv.ParseFloat(arg, 64)
+}
@@ -0,0 +1,145 @@
+package senml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func pipelinePack() senml.SenML {
+	temp := 20.0
+	hum := 40.0
+	on := true
+	return senml.SenML{
+		Records: []senml.SenMLRecord{
+			{BaseName: "room1/", BaseTime: 1600000000, Name: "temp", Unit: "Cel", Value: &temp},
+			{Name: "hum", Unit: "%RH", Value: &hum, Time: 10},
+			{Name: "light", BoolValue: &on, Time: 20},
+			{Name: "label", StringValue: "kitchen", Time: 30},
+		},
+	}
+}
+
+func names(s senml.SenML) string {
+	var n []string
+	for _, r := range s.Records {
+		n = append(n, r.Name)
+	}
+	return strings.Join(n, ",")
+}
+
+func TestPipelineStages(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"name room1/*", "room1/temp,room1/hum,room1/light,room1/label"},
+		{"name room1/h*", "room1/hum"},
+		{"regexp (temp|light)$", "room1/temp,room1/light"},
+		{"time 1600000010 1600000030", "room1/hum,room1/light"},
+		{"time 1600000020 -", "room1/light,room1/label"},
+		{"kind vb vs", "room1/light,room1/label"},
+		{"rename room1/* kitchen/", "kitchen/temp,kitchen/hum,kitchen/light,kitchen/label"},
+		{"rename room1/temp t; name t", "t"},
+		{"# only numbers\nkind v\n\ndrop u", "room1/temp,room1/hum"},
+		{"drop v", "room1/light,room1/label"},
+	}
+	for _, test := range tests {
+		p, err := senml.ParsePipeline(test.spec)
+		if err != nil {
+			t.Fatalf("ParsePipeline of %q got %v", test.spec, err)
+		}
+		s, err := p.Apply(pipelinePack())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(s); got != test.want {
+			t.Errorf("Pipeline %q got %s", test.spec, got)
+		}
+	}
+}
+
+func TestPipelineScale(t *testing.T) {
+	p, err := senml.ParsePipeline("scale */temp 1.8 32; drop ut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := p.Apply(pipelinePack())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *s.Records[0].Value != 68 || *s.Records[1].Value != 40 {
+		t.Error("Scale got", *s.Records[0].Value, *s.Records[1].Value)
+	}
+
+	// stages can also be put together in Go
+	kind, _ := senml.FilterKind("v")
+	p = senml.Pipeline{kind, senml.Rename("room1/hum", "humidity")}
+	s, err = p.Apply(pipelinePack())
+	if err != nil || names(s) != "room1/temp,humidity" {
+		t.Error("Pipeline from Go got", names(s), err)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	for _, spec := range []string{"bogus", "name", "name [", "regexp (", "kind x", "drop n", "scale * x", "time 1"} {
+		_, err := senml.ParsePipeline(spec)
+		if err == nil {
+			t.Errorf("ParsePipeline of %q should fail", spec)
+		}
+	}
+}
+
+func TestPipelineSumOnly(t *testing.T) {
+	s, err := senml.Decode([]byte(`[{"bn":"meter/","bt":1600000000,"n":"energy","u":"J","s":5}]`), senml.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := senml.ParsePipeline("kind s; scale */energy 2 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = p.Apply(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(s) != "meter/energy" || *s.Records[0].Sum != 10 {
+		t.Errorf("Pipeline on a sum got %+v", s.Records)
+	}
+}
+
+func TestPipelineQuoting(t *testing.T) {
+	s := senml.SenML{Records: []senml.SenMLRecord{
+		{Name: "x#y", StringValue: "a;b", Time: 1600000000},
+		{Name: "x", StringValue: "a", Time: 1600000000},
+	}}
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{`where n == "x#y" # a comment`, "x#y"},
+		{`where vs == "a;b"; name x*`, "x#y"},
+		{`where vs != "a;b"`, "x"},
+		{`regexp "^x#"`, "x#y"},
+		{`rename "x#y" "a b"; name "a b"`, "a b"},
+	}
+	for _, test := range tests {
+		p, err := senml.ParsePipeline(test.spec)
+		if err != nil {
+			t.Errorf("ParsePipeline of %q: %v", test.spec, err)
+			continue
+		}
+		out, err := p.Apply(s)
+		if err != nil || names(out) != test.want {
+			t.Errorf("%q got %s, %v, want %s", test.spec, names(out), err, test.want)
+		}
+	}
+
+	_, err := senml.ParsePipeline(`where n == "x`)
+	if err == nil {
+		t.Error("unterminated string accepted")
+	}
+}
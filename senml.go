@@ -3,16 +3,16 @@ package senml
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"reflect"
+	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/ugorji/go/codec"
 )
 
 type Format int
@@ -25,25 +25,99 @@ const (
 	MPACK
 	LINEP
 	JSONLINE
+	TABLE
+	CBORDIAG
+	CBORHEX
 )
 
-var fields = map[int]string{
-	-1: "BaseVersion",
-	-2: "BaseName",
-	-3: "BaseTime",
-	-4: "BaseUnit",
-	0:  "Name",
-	1:  "Unit",
-	2:  "Value",
-	3:  "StringValue",
-	4:  "BoolValue",
-	5:  "Sum",
-	6:  "Time",
-	7:  "UpdateTime",
-	8:  "DataValue",
+// formatNames are the names ParseFormat takes and String returns
+var formatNames = map[Format]string{
+	JSON:     "json",
+	XML:      "xml",
+	CBOR:     "cbor",
+	CSV:      "csv",
+	MPACK:    "mpack",
+	LINEP:    "linp",
+	JSONLINE: "jsonl",
+	TABLE:    "table",
+	CBORDIAG: "cbordiag",
+	CBORHEX:  "cborhex",
+}
+
+func (f Format) String() string {
+	name, ok := formatNames[f]
+	if !ok {
+		return "Format(" + strconv.Itoa(int(f)) + ")"
+	}
+	return name
+}
+
+// ParseFormat returns the format with the given name, such as "json" or
+// "cbor"
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown SenML format %q", name)
+}
+
+// FormatForFile guesses the format of a file from its extension
+func FormatForFile(name string) (Format, bool) {
+	formats := map[string]Format{
+		".json":    JSON,
+		".senml":   JSON,
+		".xml":     XML,
+		".cbor":    CBOR,
+		".mpack":   MPACK,
+		".msgpack": MPACK,
+		".jsonl":   JSONLINE,
+		".diag":    CBORDIAG,
+		".edn":     CBORDIAG,
+		".hex":     CBORHEX,
+	}
+	format, ok := formats[strings.ToLower(filepath.Ext(name))]
+	return format, ok
+}
+
+// DetectFormat guesses the format of a message from its content. It tries
+// the formats the first byte allows, returning the first that decodes, even
+// to SenML that is not valid.
+func DetectFormat(msg []byte) (Format, bool) {
+	var candidates []Format
+
+	text := bytes.TrimSpace(msg)
+	if len(text) == 0 {
+		return 0, false
+	}
+	c := text[0]
+	switch {
+	case c == '[':
+		candidates = []Format{JSON, CBORDIAG}
+	case c == '{':
+		candidates = []Format{JSONLINE}
+	case c == '<':
+		candidates = []Format{XML}
+	case c == '#' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'):
+		candidates = []Format{CBORHEX}
+	default:
+		candidates = []Format{CBOR, MPACK}
+	}
+
+	for _, format := range candidates {
+		_, err := Decode(msg, format)
+		if err == nil || errors.Is(err, ErrNotValid) {
+			return format, true
+		}
+	}
+	return 0, false
 }
 
 type OutputOptions struct {
+	// PrettyPrint spreads JSON and XML over lines, aligns the columns of
+	// CSV, turns CBOR and MessagePack into diagnostic notation text and
+	// annotates CBOR hex dumps.
 	PrettyPrint bool
 	Topic       string
 }
@@ -69,6 +143,10 @@ type SenMLRecord struct {
 	BoolValue   *bool    `json:"vb,omitempty"  xml:"vb,attr,omitempty"`
 
 	Sum *float64 `json:"s,omitempty"  xml:"s,attr,omitempty"`
+
+	// arrived is set by Normalize on a record whose relative time it made
+	// absolute, so stages of a Pipeline can still tell
+	arrived bool
 }
 
 type record map[int]interface{}
@@ -80,49 +158,63 @@ func (r record) str(f int) string {
 	return ""
 }
 
+func (r record) data(f int) string {
+	if v, ok := r[f].([]byte); ok {
+		return base64.RawURLEncoding.EncodeToString(v)
+	}
+	return r.str(f)
+}
+
 func (r record) int(f int) int {
-	if v, ok := r[f].(int); ok {
-		return v
+	if v, ok := toFloat(r[f]); ok {
+		return int(v)
 	}
 	return 0
 }
 
 func (r record) float(f int) float64 {
-	if v, ok := r[f].(float64); ok {
+	if v, ok := toFloat(r[f]); ok {
 		return v
 	}
 	return 0
 }
 
-func (rec SenMLRecord) toRecord() record {
-	ret := record{}
-	val := reflect.ValueOf(rec)
-	for k, v := range fields {
-		f := val.FieldByName(v)
-		if f.IsValid() && !f.IsZero() {
-			ret[k] = f.Interface()
-		}
+// toFloat converts any of the numeric types the decoders produce to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
 	}
-
-	return ret
+	return 0, false
 }
 
 type SenML struct {
-	XMLName *bool  `json:"_,omitempty" xml:"sensml"`
-	Xmlns   string `json:"_,omitempty" xml:"xmlns,attr"`
+	XMLName *bool  `json:"-" xml:"sensml"`
+	Xmlns   string `json:"-" xml:"xmlns,attr"`
 
 	Records []SenMLRecord ` xml:"senml"`
 }
 
-func (records SenML) toRecords() []map[int]interface{} {
-	var ret []map[int]interface{}
-	for _, r := range records.Records {
-		ret = append(ret, r.toRecord())
-	}
-
-	return ret
-}
-
 func (records *SenML) fromRecords(recs []record) {
 	for _, r := range recs {
 		rec := SenMLRecord{
@@ -135,97 +227,306 @@ func (records *SenML) fromRecords(recs []record) {
 			StringValue: r.str(3),
 			Time:        r.float(6),
 			UpdateTime:  r.float(7),
-			DataValue:   r.str(8),
+			DataValue:   r.data(8),
 		}
-		if v, ok := r[2].(float64); ok {
+		if v, ok := toFloat(r[2]); ok {
 			rec.Value = &v
 		}
 		if v, ok := r[4].(bool); ok {
 			rec.BoolValue = &v
 		}
-		if v, ok := r[5].(float64); ok {
+		if v, ok := toFloat(r[5]); ok {
 			rec.Sum = &v
 		}
 		records.Records = append(records.Records, rec)
 	}
 }
 
+// ErrNotValid is wrapped by the error returned when a decoded pack breaks
+// the rules of RFC 8428. The pack is returned with it so Validate can list
+// every problem.
+var ErrNotValid = errors.New("SenML record not valid")
+
+// DecodeOptions controls how DecodeWithOptions parses a message.
+type DecodeOptions struct {
+	// Lenient accepts the field names and encodings used by the drafts that
+	// preceded RFC 8428, such as "ver" instead of "bver".
+	Lenient bool
+
+	// Strict rejects unknown fields, duplicate fields, values of the wrong
+	// type and anything following the pack. It can not be combined with
+	// Lenient.
+	Strict bool
+
+	// Extensions lists the extension fields a strict decode accepts.
+	Extensions []string
+
+	// MaxBytes, MaxRecords, MaxNameLength and MaxValueLength limit the size
+	// of the message, the number of records in it, the length of resolved
+	// names and the length of string and data values. Zero means no limit.
+	// Lengths are in bytes, and a data value is measured decoded, so the
+	// same pack meets the limit in every format. A lenient decode only
+	// checks MaxRecords, MaxNameLength and MaxValueLength once the whole
+	// pack is decoded, leaving MaxBytes to bound the memory it takes.
+	MaxBytes       int
+	MaxRecords     int
+	MaxNameLength  int
+	MaxValueLength int
+
+	// SkipBadLines makes a JSONLINE decode skip the lines that can not be
+	// decoded, listing them in the DecodeReport, instead of failing.
+	SkipBadLines bool
+}
+
+// DecodeReport describes what DecodeWithOptions noticed while decoding a
+// message that did not stop it from being decoded.
+type DecodeReport struct {
+	// Legacy lists each draft-era construct accepted by a lenient decode.
+	Legacy []string
+
+	// Skipped lists the JSONLINE lines skipped because of SkipBadLines.
+	Skipped []*LineError
+}
+
+func (report *DecodeReport) legacy(construct string) {
+	for _, l := range report.Legacy {
+		if l == construct {
+			return
+		}
+	}
+	report.Legacy = append(report.Legacy, construct)
+}
+
 // Decode takes a SenML message in the given format and parses it and decodes it
 // into the returned SenML record.
 func Decode(msg []byte, format Format) (SenML, error) {
+	return defaultCodec.Decode(msg, format)
+}
+
+// DecodeWithOptions is like Decode but lets the caller control the parsing
+// and returns a report of what was seen along the way.
+func DecodeWithOptions(msg []byte, format Format, options DecodeOptions) (SenML, DecodeReport, error) {
+	return defaultCodec.DecodeWithOptions(msg, format, options)
+}
+
+// Decode is the package Decode, with the handles of the codec.
+func (c *Codec) Decode(msg []byte, format Format) (SenML, error) {
+	s, _, err := c.DecodeWithOptions(msg, format, DecodeOptions{})
+	return s, err
+}
+
+// DecodeWithOptions is the package DecodeWithOptions, with the handles of
+// the codec.
+func (c *Codec) DecodeWithOptions(msg []byte, format Format, options DecodeOptions) (SenML, DecodeReport, error) {
 	var s SenML
+	var report DecodeReport
 	var err error
 
 	s.XMLName = nil
 	s.Xmlns = "urn:ietf:params:xml:ns:senml"
 
+	if options.MaxBytes > 0 && len(msg) > options.MaxBytes {
+		return s, report, fmt.Errorf("%w: message longer than %d bytes", ErrLimitExceeded, options.MaxBytes)
+	}
+	lim := newLimits(options)
+
+	// diagnostic notation and hex dumps are read as the CBOR they describe
 	switch {
-	case format == JSON:
-		// parse the input JSON stream
-		err = json.Unmarshal(msg, &s.Records)
+	case format == CBORDIAG:
+		msg, err = parseDiag(msg)
+		format = CBOR
+	case format == CBORHEX:
+		msg, err = parseHex(msg)
+		format = CBOR
+	}
+	if err != nil {
+		return s, report, err
+	}
+
+	if options.Strict {
+		if options.Lenient {
+			return s, report, errors.New("strict and lenient decoding can not be combined")
+		}
+		err = newStrictChecker(options.Extensions).check(msg, format)
 		if err != nil {
-			//fmt.Println("error parsing JSON SenML Stream: ", err)
-			//fmt.Println("msg=", msg)
-			return s, err
+			return s, report, err
 		}
+	}
 
+	switch {
 	case format == JSONLINE:
-		// parse the input JSON line
-		lines := strings.Split(string(msg), "\n")
-		for _, line := range lines {
-			r := new(SenMLRecord)
-			if len(line) > 5 {
-				err = json.Unmarshal([]byte(line), r)
-				if err != nil {
-					//fmt.Println("error parsing JSON SenML Line: ", err)
-					return s, err
-				}
-				s.Records = append(s.Records, *r)
-			}
+		// parse the input JSON lines
+		s.Records, err = decodeJSONLines(msg, options, &report)
+		if err != nil {
+			return s, report, err
+		}
+
+	case options.Lenient:
+		s.Records, err = c.decodeLenient(msg, format, &report)
+		if err == nil {
+			err = lim.addAll(s.Records)
+		}
+		if err != nil {
+			return s, report, err
+		}
+
+	case format == JSON:
+		// parse the input JSON stream
+		s.Records, err = decodeJSON(msg, lim)
+		if err != nil {
+			return s, report, err
 		}
 
 	case format == XML:
 		// parse the input XML
-		err = xml.Unmarshal(msg, &s)
+		s.Records, err = decodeXML(msg, lim)
 		if err != nil {
-			//fmt.Println("error parsing XML SenML", err)
-			return s, err
+			return s, report, err
 		}
 
 	case format == CBOR:
 		// parse the input CBOR
-		var cborHandle codec.Handle = new(codec.CborHandle)
-		var decoder *codec.Decoder = codec.NewDecoderBytes(msg, cborHandle)
-		rec := []record{}
-		err = decoder.Decode(&rec)
+		if lim.set() {
+			var pack item
+			pack, _, err = readCBOR(msg)
+			if err == nil {
+				err = lim.items(pack)
+			}
+			if err != nil {
+				return s, report, err
+			}
+		}
+		records, ok := decodeCBORRecords(msg)
+		if ok {
+			s.Records = records
+		} else {
+			rec := []record{}
+			err = decode(&c.cborDecoders, msg, &rec)
+			if err != nil {
+				return s, report, err
+			}
+			s.fromRecords(rec)
+		}
+		err = lim.addAll(s.Records)
 		if err != nil {
-			//fmt.Println("error parsing CBOR SenML", err)
-			return s, err
+			return s, report, err
 		}
-		s.fromRecords(rec)
 
 	case format == MPACK:
 		// parse the input MPACK
 		// spec for MessagePack is at https://github.com/msgpack/msgpack/
-		var mpackHandle codec.Handle = new(codec.MsgpackHandle)
-		var decoder *codec.Decoder = codec.NewDecoderBytes(msg, mpackHandle)
-		err = decoder.Decode(&s.Records)
+		if lim.set() {
+			var pack item
+			pack, _, err = readMsgpack(msg)
+			if err == nil {
+				err = lim.items(pack)
+			}
+			if err != nil {
+				return s, report, err
+			}
+		}
+		err = decode(&c.mpackDecoders, msg, &s.Records)
+		if err != nil {
+			return s, report, err
+		}
+		err = lim.addAll(s.Records)
 		if err != nil {
-			//fmt.Println("error parsing MPACK SenML", err)
-			return s, err
+			return s, report, err
 		}
 
 	}
 
-	if !IsValid(s) {
-		return s, errors.New("SenML record not valid")
+	if problems := Validate(s); len(problems) > 0 {
+		return s, report, fmt.Errorf("%w: %v", ErrNotValid, problems[0])
+	}
+
+	return s, report, nil
+}
+
+// decodeJSON parses a JSON array of records one record at a time so the
+// limits can stop it part way through
+func decodeJSON(msg []byte, lim *limits) ([]SenMLRecord, error) {
+	var records []SenMLRecord
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != nil {
+		if tok != json.Delim('[') {
+			return nil, errors.New("SenML pack is not an array")
+		}
+		for decoder.More() {
+			var r SenMLRecord
+			err = decoder.Decode(&r)
+			if err == nil {
+				err = lim.add(r)
+			}
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, r)
+		}
+		_, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = decoder.Token()
+	if err != io.EOF {
+		return nil, errTrailingData
 	}
 
-	return s, nil
+	return records, nil
+}
+
+// decodeXML parses the <senml> records in the root element one at a time so
+// the limits can stop it part way through
+func decodeXML(msg []byte, lim *limits) ([]SenMLRecord, error) {
+	var records []SenMLRecord
+
+	decoder := xml.NewDecoder(bytes.NewReader(msg))
+	depth := 0
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 && t.Name.Local == "senml" {
+				var r SenMLRecord
+				err = decoder.DecodeElement(&r, &t)
+				if err == nil {
+					err = lim.add(r)
+				}
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, r)
+				continue
+			}
+			depth += 1
+
+		case xml.EndElement:
+			depth -= 1
+			if depth == 0 {
+				return records, nil
+			}
+		}
+	}
 }
 
 // Encode takes a SenML record, and encodes it using the given format.
 func Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
+	return defaultCodec.Encode(s, format, options)
+}
+
+// Encode is the package Encode, with the options and handles of the codec.
+func (c *Codec) Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
 	var data []byte
 	var err error
 
@@ -238,29 +539,15 @@ func Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
 	switch {
 
 	case format == JSON:
-		// ouput JSON version
-		if options.PrettyPrint {
-			// data, err = json.MarshalIndent(s.Records, "", "  ")
-			var lines string
-			lines += fmt.Sprintf("[\n  ")
-			for i, r := range s.Records {
-				if i != 0 {
-					lines += ",\n  "
-				}
-				recData, err := json.Marshal(r)
-				if err != nil {
-					//fmt.Println("error encoding JSON SenML", err)
-					return nil, err
-				}
-				lines += fmt.Sprintf("%s", recData)
-			}
-			lines += fmt.Sprintf("\n]\n")
-			data = []byte(lines)
-		} else {
+		// ouput JSON version, one record per line when pretty printing
+		if s.Records == nil && !options.PrettyPrint {
 			data, err = json.Marshal(s.Records)
+		} else {
+			data, err = pooled(func(b []byte) ([]byte, error) {
+				return appendJSONRecords(b, s.Records, options.PrettyPrint)
+			})
 		}
 		if err != nil {
-			//fmt.Println("error encoding JSON SenML", err)
 			return nil, err
 		}
 
@@ -278,47 +565,56 @@ func Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
 
 	case format == CSV:
 		// output a CSV version
-		var lines string
+		if !options.PrettyPrint {
+			data, _ = pooled(func(b []byte) ([]byte, error) {
+				return appendCSV(b, s.Records), nil
+			})
+			break
+		}
+		var rows [][]string
 		for _, r := range s.Records {
 			if r.Value != nil {
-				// TODO - replace sprintf with bytes.Buffer
-				lines += fmt.Sprintf("%s,", r.Name)
 				// excell time in days since 1900, unix seconds since 1970
 				// ( 1970 is 25569 days after 1900 )
-				lines += fmt.Sprintf("%f,", (r.Time/(24.0*3600.0))+25569.0)
-				lines += fmt.Sprintf("%f", *r.Value)
+				row := []string{
+					r.Name,
+					strconv.FormatFloat((r.Time/(24.0*3600.0))+25569.0, 'f', 6, 64),
+					strconv.FormatFloat(*r.Value, 'f', 6, 64),
+				}
 				if len(r.Unit) > 0 {
-					lines += fmt.Sprintf(",%s", r.Unit)
+					row = append(row, r.Unit)
 				}
-				lines += fmt.Sprintf("\r\n")
+				rows = append(rows, row)
 			}
 		}
-		data = []byte(lines)
-		if err != nil {
-			//fmt.Println("error encoding CSV SenML", err)
-			return nil, err
-		}
+		data = writeCSV(rows, options.PrettyPrint)
 
 	case format == CBOR:
 		// output a CBOR version
-		var cborHandle codec.Handle = new(codec.CborHandle)
-		var encoder *codec.Encoder = codec.NewEncoderBytes(&data, cborHandle)
-		cborData := s.toRecords()
-		err = encoder.Encode(cborData)
-		if err != nil {
-			//fmt.Println("error encoding CBOR SenML", err)
-			return nil, err
+		data, _ = pooled(func(b []byte) ([]byte, error) {
+			return appendCBORRecords(b, s.Records, c.cborOptions()), nil
+		})
+		if options.PrettyPrint {
+			data, err = cborDiag(data, true)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 	case format == MPACK:
 		// output a MPACK version
-		var mpackHandle codec.Handle = new(codec.MsgpackHandle)
-		var encoder *codec.Encoder = codec.NewEncoderBytes(&data, mpackHandle)
-		err = encoder.Encode(s.Records)
+		data, err = pooled(func(b []byte) ([]byte, error) {
+			return c.encodeMsgpack(b, s.Records)
+		})
 		if err != nil {
-			//fmt.Println("error encoding MPACK SenML", err)
 			return nil, err
 		}
+		if options.PrettyPrint {
+			data, err = msgpackDiag(data, true)
+			if err != nil {
+				return nil, err
+			}
+		}
 
 	case format == LINEP:
 		// ouput Line Protocol
@@ -344,20 +640,32 @@ func Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
 		data = buf.Bytes()
 
 	case format == JSONLINE:
-		// ouput Line Protocol
-		var buf bytes.Buffer
-		for _, r := range s.Records {
-			if r.Value != nil {
-				data, err = json.Marshal(r)
-				if err != nil {
-					//fmt.Println("error encoding JSONLINE SenML", err)
-					return nil, err
-				}
-				buf.Write(data)
-				buf.WriteString("\n")
-			}
+		// ouput a JSON record per line
+		data, err = pooled(func(b []byte) ([]byte, error) {
+			return appendJSONLines(b, s.Records)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case format == TABLE:
+		// output a table for people to read
+		data = writeTable(s.Records)
+
+	case format == CBORDIAG || format == CBORHEX:
+		// output the CBOR version as diagnostic notation or hex
+		data, err = c.Encode(s, CBOR, OutputOptions{Topic: options.Topic})
+		if err != nil {
+			return nil, err
+		}
+		if format == CBORDIAG {
+			data, err = cborDiag(data, options.PrettyPrint)
+		} else {
+			data, err = cborHex(data, options.PrettyPrint)
+		}
+		if err != nil {
+			return nil, err
 		}
-		data = buf.Bytes()
 	}
 
 	return data, nil
@@ -366,15 +674,27 @@ func Encode(s SenML, format Format, options OutputOptions) ([]byte, error) {
 // Removes all the base items and expands records to have items that include
 // what previosly in base iterms. Convets relative times to absoltue times.
 func Normalize(senml SenML) SenML {
+	return normalizeAt(senml, time.Now(), 5)
+}
+
+// resolve is Normalize without a default version, so bver is only set on the
+// records of packs that set it
+func resolve(senml SenML) SenML {
+	return normalizeAt(senml, time.Now(), 0)
+}
+
+// normalizeAt is Normalize with relative times taken from now, or left
+// relative when now is zero, and version put on records when no bver is set
+func normalizeAt(senml SenML, now time.Time, version int) SenML {
 	var bname string = ""
 	var btime float64 = 0
 	var bunit string = ""
-	var ver = 5
+	var ver = version
 	var ret SenML
 
 	var totalRecords int = 0
 	for _, r := range senml.Records {
-		if (r.Value != nil) || (len(r.StringValue) > 0) || (len(r.DataValue) > 0) || (r.BoolValue != nil) {
+		if (r.Value != nil) || (len(r.StringValue) > 0) || (len(r.DataValue) > 0) || (r.BoolValue != nil) || (r.Sum != nil) {
 			totalRecords += 1
 		}
 	}
@@ -407,14 +727,14 @@ func Normalize(senml SenML) SenML {
 		}
 		r.BaseVersion = ver
 
-		if r.Time <= 0 {
+		if r.Time <= 0 && !now.IsZero() {
 			// convert to absolute time
-			var now int64 = time.Now().UnixNano()
-			var t int64 = now / 1000000000.0
+			var t int64 = now.UnixNano() / 1000000000.0
 			r.Time = float64(t) + r.Time
+			r.arrived = true
 		}
 
-		if (r.Value != nil) || (len(r.StringValue) > 0) || (len(r.DataValue) > 0) || (r.BoolValue != nil) {
+		if (r.Value != nil) || (len(r.StringValue) > 0) || (len(r.DataValue) > 0) || (r.BoolValue != nil) || (r.Sum != nil) {
 			ret.Records[numRecords] = r
 			numRecords += 1
 		}
@@ -425,84 +745,5 @@ func Normalize(senml SenML) SenML {
 
 // Test if SenML is valid
 func IsValid(senml SenML) bool {
-	var bname string = ""
-	var bver = -1
-
-	//fmt.Println("In Validate")
-
-	for _, r := range senml.Records {
-
-		// Check version is same for all records
-		if bver == -1 {
-			// set the bver the first time it is seen
-			if r.BaseVersion != 0 {
-				bver = r.BaseVersion
-			}
-		} else {
-			if r.BaseVersion != 0 {
-				// next time a version in seen, check it has not changed
-				if r.BaseVersion != bver {
-					//fmt.Println("unallowed version change ")
-					return false
-				}
-			}
-		}
-
-		// Check name
-		if len(r.BaseName) > 0 {
-			bname = r.BaseName
-		}
-		name := bname + r.Name
-		if len(name) == 0 {
-			//fmt.Println("empty name")
-
-			return false
-		}
-		if (name[0] == '-') || (name[0] == ':') || (name[0] == '.') || (name[0] == '/') || (name[0] == '_') {
-			//fmt.Println("Bad first char in name")
-			return false
-		}
-		for _, l := range name {
-			if (l < 'a' || l > 'z') && (l < 'A' || l > 'Z') && (l < '0' || l > '9') && (l != '-') && (l != ':') && (l != '.') && (l != '/') && (l != '_') {
-				//fmt.Println("Bad char in name")
-				return false
-			}
-		}
-
-		valueCount := 0
-		if r.Value != nil {
-			valueCount = valueCount + 1
-		}
-		if r.BoolValue != nil {
-			valueCount = valueCount + 1
-		}
-		if len(r.DataValue) > 0 {
-			valueCount = valueCount + 1
-		}
-		if len(r.StringValue) > 0 {
-			valueCount = valueCount + 1
-		}
-		if valueCount > 1 {
-			//fmt.Println("Too many values ")
-			return false
-		}
-		if r.Sum != nil {
-			valueCount = valueCount + 1
-		}
-		if valueCount < 1 {
-			//fmt.Println("No value or sum")
-			return false
-		}
-
-		// Check if name is known Mandatory To Understand
-		//for k :=  r {
-		// 	fmt.Println( "key=" , k  )
-		//         if k[ len(k)-1 ] == '_' {
-		//         	fmt.Println("unknown MTU in record")
-		//		return false
-		//        }
-		// }
-	}
-
-	return true
+	return len(Validate(senml)) == 0
 }
@@ -2,13 +2,15 @@ package senml_test
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/cisco/senml"
 	"strconv"
+	"strings"
 	"testing"
 )
 
-func ExampleEncode1() {
+func ExampleEncode_single() {
 	v := 23.1
 	s := senml.SenML{
 		Records: []senml.SenMLRecord{
@@ -25,7 +27,7 @@ func ExampleEncode1() {
 	// Output: [{"n":"urn:dev:ow:10e2073a01080063","u":"Cel","v":23.1}]
 }
 
-func ExampleEncode2() {
+func ExampleEncode_baseName() {
 	v1 := 23.5
 	v2 := 23.6
 	s := senml.SenML{
@@ -53,10 +55,10 @@ type TestVector struct {
 
 var testVectors = []TestVector{
 	{true, senml.JSON, false, "W3siYm4iOiJkZXYxMjMiLCJidCI6LTQ1LjY3LCJidSI6ImRlZ0MiLCJidmVyIjo1LCJuIjoidGVtcCIsInUiOiJkZWdDIiwidCI6LTEsInV0IjoxMCwidiI6MjIuMSwicyI6MH0seyJuIjoicm9vbSIsInQiOi0xLCJ2cyI6ImtpdGNoZW4ifSx7Im4iOiJkYXRhIiwidmQiOiJhYmMifSx7Im4iOiJvayIsInZiIjp0cnVlfV0="},
-	{true, senml.CBOR, true, "hKxhX/ZiYm5mZGV2MTIzYmJ0+8BG1cKPXCj2YmJ1ZGRlZ0NkYnZlcgVhbmR0ZW1wYXP7AAAAAAAAAABhdPu/8AAAAAAAAGF1ZGRlZ0NidXT7QCQAAAAAAABhdvtANhmZmZmZmmJ2YvanYV/2YW5kcm9vbWFz9mF0+7/wAAAAAAAAYXb2YnZi9mJ2c2draXRjaGVupmFf9mFuZGRhdGFhc/ZhdvZidmL2YnZkY2FiY6VhX/ZhbmJva2Fz9mF29mJ2YvU="},
+	{true, senml.CBOR, true, "hKojZGRlZ0Mi+8BG1cKPXCj2IWZkZXYxMjMgBQBkdGVtcAFkZGVnQwL7QDYZmZmZmZoF+wAAAAAAAAAABvu/8AAAAAAAAAf7QCQAAAAAAACjAGRyb29tA2draXRjaGVuBvu/8AAAAAAAAKIAZGRhdGEIY2FiY6IAYm9rBPU="},
 	{true, senml.XML, false, "PHNlbnNtbCB4bWxucz0idXJuOmlldGY6cGFyYW1zOnhtbDpuczpzZW5tbCI+PHNlbm1sIGJuPSJkZXYxMjMiIGJ0PSItNDUuNjciIGJ1PSJkZWdDIiBidmVyPSI1IiBuPSJ0ZW1wIiB1PSJkZWdDIiB0PSItMSIgdXQ9IjEwIiB2PSIyMi4xIiBzPSIwIj48L3Nlbm1sPjxzZW5tbCBuPSJyb29tIiB0PSItMSIgdnM9ImtpdGNoZW4iPjwvc2VubWw+PHNlbm1sIG49ImRhdGEiIHZkPSJhYmMiPjwvc2VubWw+PHNlbm1sIG49Im9rIiB2Yj0idHJ1ZSI+PC9zZW5tbD48L3NlbnNtbD4="},
 	{false, senml.CSV, false, "dGVtcCwyNTU2OC45OTk5ODgsMjIuMTAwMDAwLGRlZ0MNCg=="},
-	{true, senml.MPACK, true, "lIyhX8CiYm6mZGV2MTIzomJ0y8BG1cKPXCj2omJ1pGRlZ0OkYnZlcgWhbqR0ZW1woXPLAAAAAAAAAAChdMu/8AAAAAAAAKF1pGRlZ0OidXTLQCQAAAAAAAChdstANhmZmZmZmqJ2YsCHoV/AoW6kcm9vbaFzwKF0y7/wAAAAAAAAoXbAonZiwKJ2c6draXRjaGVuhqFfwKFupGRhdGGhc8ChdsCidmLAonZko2FiY4WhX8ChbqJva6FzwKF2wKJ2YsM="},
+	{true, senml.MPACK, true, "lIqiYm6mZGV2MTIzomJ0y8BG1cKPXCj2omJ1pGRlZ0OkYnZlcgWhbqR0ZW1woXPLAAAAAAAAAAChdMu/8AAAAAAAAKF1pGRlZ0OidXTLQCQAAAAAAAChdstANhmZmZmZmoOhbqRyb29toXTLv/AAAAAAAACidnOna2l0Y2hlboKhbqRkYXRhonZko2FiY4KhbqJva6J2YsM="},
 	{false, senml.LINEP, false, "Zmx1ZmZ5U2VubWwsbj10ZW1wLHU9ZGVnQyB2PTIyLjEscz0wIC0xMDAwMDAwMDAwCg=="},
 }
 
@@ -224,14 +226,13 @@ func TestBadInputNumericBaseName(t *testing.T) {
 	}
 }
 
-// TODO add
-//func TestBadInputUnknownMtuField(t *testing.T) {
-//	data := []byte("[ { \"n\":\"hi\", \"v\":1.0, \"mtu_\":1.0  } ] ")
-//	_ , err := senml.Decode(data, senml.JSON)
-//	if err == nil {
-//		t.Fail()
-//	}
-//}
+func TestBadInputUnknownMtuField(t *testing.T) {
+	data := []byte("[ { \"n\":\"hi\", \"v\":1.0, \"mtu_\":1.0  } ] ")
+	_, _, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Strict: true})
+	if err == nil {
+		t.Fail()
+	}
+}
 
 func TestInputSumOnly(t *testing.T) {
 	data := []byte("[ { \"n\":\"a\", \"s\":1.0 } ] ")
@@ -264,3 +265,349 @@ func TestInputString(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestLenientVersion(t *testing.T) {
+	data := []byte(`[{"bn":"urn:dev:mac:0024befffe804ff1/","bt":1276020076,"bu":"A","ver":2,"n":"voltage","u":"V","v":0}]`)
+	s, err := senml.Decode(data, senml.JSON)
+	if err != nil || s.Records[0].BaseVersion != 0 {
+		t.Fatal("Decode got", s.Records, err)
+	}
+	s, report, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Records[0].BaseVersion != 2 {
+		t.Error("Lenient decode lost version")
+	}
+	if len(report.Legacy) != 1 || report.Legacy[0] != `"ver" field` {
+		t.Error("Lenient decode reported", report.Legacy)
+	}
+}
+
+func TestLenientDraftPack(t *testing.T) {
+	data := []byte(`{"e":[{"n":"temp","v":20.5,"t":"2010-06-08T18:01:16Z"},{"n":"on","bv":true}],"bn":"dev/","ver":2}`)
+	s, report, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Records) != 2 || s.Records[0].BaseName != "dev/" || s.Records[0].Time != 1276020076 || s.Records[1].BoolValue == nil {
+		t.Error("Lenient decode of draft pack got", s.Records)
+	}
+	if len(report.Legacy) != 4 {
+		t.Error("Lenient decode reported", report.Legacy)
+	}
+}
+
+func TestLenientReportOrder(t *testing.T) {
+	data := []byte(`[{"n":"a","ver":2,"sv":"x"},{"n":"b","bv":true}]`)
+	for i := 0; i < 20; i++ {
+		_, report, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Lenient: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(report.Legacy, ","); got != `"sv" field,"ver" field,"bv" field` {
+			t.Fatal("Lenient decode reported", got)
+		}
+	}
+}
+
+func TestLenientBaseValue(t *testing.T) {
+	data := []byte(`[{"bv":10,"n":"a","v":1},{"n":"b","v":2},{"n":"c","vs":"x"}]`)
+	s, report, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *s.Records[0].Value != 11 || *s.Records[1].Value != 12 || s.Records[0].BoolValue != nil || s.Records[2].Value != nil {
+		t.Error("Lenient decode of a base value got", s.Records)
+	}
+	if len(report.Legacy) != 0 {
+		t.Error("Lenient decode of a base value reported", report.Legacy)
+	}
+}
+
+func TestLenientCBORTextLabels(t *testing.T) {
+	// [{"n": "a", "v": 1, -1: 5}]
+	data := []byte{0x81, 0xa3, 0x61, 'n', 0x61, 'a', 0x61, 'v', 0x01, 0x20, 0x05}
+	_, err := senml.Decode(data, senml.CBOR)
+	if err == nil {
+		t.Error("Decode accepted text labels in CBOR")
+	}
+	s, report, err := senml.DecodeWithOptions(data, senml.CBOR, senml.DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Records[0].Name != "a" || *s.Records[0].Value != 1 || s.Records[0].BaseVersion != 5 {
+		t.Error("Lenient CBOR decode got", s.Records)
+	}
+	if len(report.Legacy) != 1 {
+		t.Error("Lenient decode reported", report.Legacy)
+	}
+}
+
+func TestLenientXMLDraft(t *testing.T) {
+	data := []byte(`<senml xmlns="urn:ietf:params:xml:ns:senml" bn="dev/" ver="2"><e n="temp" v="20.5"/><e n="room" sv="kitchen"/></senml>`)
+	s, _, err := senml.DecodeWithOptions(data, senml.XML, senml.DecodeOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Records) != 2 || s.Records[0].BaseVersion != 2 || s.Records[1].StringValue != "kitchen" {
+		t.Error("Lenient XML decode got", s.Records)
+	}
+}
+
+func TestStrictAcceptsEncoded(t *testing.T) {
+	for i, vector := range testVectors {
+		if !vector.testDecode {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(vector.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = senml.DecodeWithOptions(data, vector.format, senml.DecodeOptions{Strict: true})
+		if err != nil {
+			t.Error("Strict decode of vector", i, "failed:", err)
+		}
+	}
+}
+
+func TestStrictRejects(t *testing.T) {
+	bad := []struct {
+		format senml.Format
+		data   string
+	}{
+		{senml.JSON, `[{"n":"a","v":1,"n":"b"}]`},
+		{senml.JSON, `[{"n":"a","v":1,"x":2}]`},
+		{senml.JSON, `[{"n":"a","v":"1"}]`},
+		{senml.JSON, `[{"n":"a","v":1}] []`},
+		{senml.JSONLINE, `{"n":"a","v":1} {}`},
+		{senml.XML, `<sensml xmlns="urn:ietf:params:xml:ns:senml"><senml n="a" v="x"></senml></sensml>`},
+		{senml.XML, `<sensml xmlns="urn:ietf:params:xml:ns:senml"><senml n="a" v="1"></senml></sensml><x/>`},
+		{senml.CBOR, "\x81\xa2\x00\x61a\x02\x01\x00"},
+		{senml.CBOR, "\x81\xa3\x00\x61a\x02\x01\x00\x61b"},
+		{senml.CBOR, "\x81\xa2\x00\x61a\x02\x61b"},
+		{senml.CBOR, "\x81\xa2\x61n\x61a\x02\x01"},
+		{senml.MPACK, "\x91\x82\xa1n\xa1a\xa1v\x01\xc0"},
+		{senml.MPACK, "\x91\x83\xa1n\xa1a\xa1v\x01\xa1n\xa1b"},
+	}
+	for i, b := range bad {
+		_, _, err := senml.DecodeWithOptions([]byte(b.data), b.format, senml.DecodeOptions{Strict: true})
+		if err == nil {
+			t.Error("Strict decode accepted bad input", i)
+		}
+	}
+}
+
+func TestStrictExtensions(t *testing.T) {
+	data := []byte(`[{"n":"a","v":1,"ext":{"x":[1,2]}}]`)
+	_, _, err := senml.DecodeWithOptions(data, senml.JSON, senml.DecodeOptions{Strict: true, Extensions: []string{"ext"}})
+	if err != nil {
+		t.Error("Strict decode rejected extension:", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	limits := []senml.DecodeOptions{
+		{MaxBytes: 16},
+		{MaxRecords: 3},
+		{MaxNameLength: 8},
+		{MaxValueLength: 4},
+	}
+	for i, vector := range testVectors {
+		if !vector.testDecode {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(vector.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, options := range limits {
+			_, _, err = senml.DecodeWithOptions(data, vector.format, options)
+			if !errors.Is(err, senml.ErrLimitExceeded) {
+				t.Error("Decode of vector", i, "with limits", j, "got", err)
+			}
+		}
+		_, _, err = senml.DecodeWithOptions(data, vector.format, senml.DecodeOptions{MaxRecords: 4, MaxNameLength: 10, MaxValueLength: 7})
+		if err != nil {
+			t.Error("Decode of vector", i, "within limits got", err)
+		}
+	}
+}
+
+func TestDecodeLimitsData(t *testing.T) {
+	// six bytes of data, written as eight base64url characters in JSON
+	s := senml.SenML{Records: []senml.SenMLRecord{{Name: "a", DataValue: "AAECAwQF"}}}
+	for _, format := range []senml.Format{senml.JSON, senml.XML, senml.CBOR, senml.MPACK} {
+		data, err := senml.Encode(s, format, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = senml.DecodeWithOptions(data, format, senml.DecodeOptions{MaxValueLength: 6})
+		if err != nil {
+			t.Error("Decode of six bytes of", format, "got", err)
+		}
+		_, _, err = senml.DecodeWithOptions(data, format, senml.DecodeOptions{MaxValueLength: 5})
+		if !errors.Is(err, senml.ErrLimitExceeded) {
+			t.Error("Decode of six bytes of", format, "with a limit of five got", err)
+		}
+	}
+}
+
+func ExampleEncode_diagnostic() {
+	v := 23.5
+	s := senml.SenML{
+		Records: []senml.SenMLRecord{
+			{BaseName: "urn:dev:ow:10e2073a01080063", Name: "temp", Unit: "Cel", Value: &v},
+		},
+	}
+
+	dataOut, err := senml.Encode(s, senml.CBOR, senml.OutputOptions{PrettyPrint: true})
+	if err != nil {
+		fmt.Println("Encode of SenML failed")
+	} else {
+		fmt.Print(string(dataOut))
+	}
+	// Output: [
+	//   {/bn/ -2: "urn:dev:ow:10e2073a01080063", /n/ 0: "temp", /u/ 1: "Cel", /v/ 2: 23.5}
+	// ]
+}
+
+func ExampleEncode_table() {
+	v1 := 23.5
+	v2 := 1.25
+	s := senml.SenML{
+		Records: []senml.SenMLRecord{
+			{BaseName: "dev/", Name: "temp", Unit: "Cel", Value: &v1},
+			{Name: "current", Unit: "A", Time: -10, Value: &v2},
+		},
+	}
+
+	dataOut, err := senml.Encode(s, senml.TABLE, senml.OutputOptions{})
+	if err != nil {
+		fmt.Println("Encode of SenML failed")
+	} else {
+		fmt.Print(string(dataOut))
+	}
+	// Output: bn    n        u      t     v
+	// ----  -------  ---  ---  ----
+	// dev/  temp     Cel       23.5
+	//       current  A    -10  1.25
+}
+
+func TestPrettyPrint(t *testing.T) {
+	value := 22.1
+	s := senml.SenML{
+		Records: []senml.SenMLRecord{
+			{Name: "temp", Value: &value, Unit: "degC"},
+			{Name: "humidity", Value: &value},
+		},
+	}
+	options := senml.OutputOptions{PrettyPrint: true}
+
+	expected := map[senml.Format]string{
+		senml.MPACK: "[\n  {\"n\": \"temp\", \"u\": \"degC\", \"v\": 22.1},\n  {\"n\": \"humidity\", \"v\": 22.1}\n]\n",
+		senml.CSV:   "temp,     25569.000000, 22.100000, degC\r\nhumidity, 25569.000000, 22.100000\r\n",
+	}
+	for format, want := range expected {
+		dataOut, err := senml.Encode(s, format, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dataOut) != want {
+			t.Errorf("Pretty print of format %d got %q", format, dataOut)
+		}
+	}
+}
+
+func TestCBORDiagRoundTrip(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(testVectors[1].value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := senml.Decode(data, senml.CBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []senml.Format{senml.CBORDIAG, senml.CBORHEX} {
+		for _, pretty := range []bool{false, true} {
+			text, err := senml.Encode(s, format, senml.OutputOptions{PrettyPrint: pretty})
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := senml.Decode(text, format)
+			if err != nil {
+				t.Fatalf("Decode of format %d got %v for %s", format, err, text)
+			}
+			dataOut, err := senml.Encode(back, senml.CBOR, senml.OutputOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dataOut) != string(data) {
+				t.Errorf("Round trip of format %d got %s", format, text)
+			}
+		}
+	}
+}
+
+func TestDecodeCBORDiag(t *testing.T) {
+	text := `/ hand written / [_ {/bn/ -2: "dev/", 0: "temp", 2: 22.5_1, 6: -1_0},
+		{0: (_ "hum", "idity"), 2: 40_3}, {0: "ok", 4: true}]`
+	s, err := senml.Decode([]byte(text), senml.CBORDIAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Records) != 3 || s.Records[1].Name != "humidity" || *s.Records[0].Value != 22.5 || s.Records[0].Time != -1 {
+		t.Error("Decode of diagnostic notation got", s.Records)
+	}
+
+	for _, bad := range []string{"[{0: \"a\", 2: 1}", "[{0: 1000_0}]", "{0: }", "h'abc'"} {
+		_, err = senml.Decode([]byte(bad), senml.CBORDIAG)
+		if err == nil {
+			t.Errorf("Decode of %q should fail", bad)
+		}
+	}
+
+	_, err = senml.Decode([]byte("81 # array(1)\n  a2 00 61 61 02 01 # {0: \"a\", 2: 1}\n"), senml.CBORHEX)
+	if err != nil {
+		t.Error("Decode of annotated hex got", err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"json", "xml", "cbor", "csv", "mpack", "linp", "jsonl", "table", "cbordiag", "cborhex"} {
+		format, err := senml.ParseFormat(name)
+		if err != nil || format.String() != name {
+			t.Error("ParseFormat", name, "got", format, err)
+		}
+	}
+	if format, err := senml.ParseFormat("CBOR"); err != nil || format != senml.CBOR {
+		t.Error("ParseFormat is case sensitive")
+	}
+	if _, err := senml.ParseFormat("yaml"); err == nil {
+		t.Error("ParseFormat took an unknown name")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	v := 1.0
+	s := senml.SenML{Records: []senml.SenMLRecord{{BaseName: "dev/", Name: "temp", Value: &v}}}
+	for _, format := range []senml.Format{senml.JSON, senml.JSONLINE, senml.XML, senml.CBOR, senml.MPACK, senml.CBORDIAG, senml.CBORHEX} {
+		data, err := senml.Encode(s, format, senml.OutputOptions{})
+		if err != nil {
+			t.Fatal("Encode", format, err)
+		}
+		if got, ok := senml.DetectFormat(data); !ok || got != format {
+			t.Error("DetectFormat of", format, "got", got, ok)
+		}
+	}
+
+	if got, ok := senml.DetectFormat([]byte(`[{"n":"a"}]`)); !ok || got != senml.JSON {
+		t.Error("DetectFormat of JSON that is not valid SenML got", got, ok)
+	}
+	for _, data := range []string{"", "hello", "\x00\x01\x02"} {
+		if got, ok := senml.DetectFormat([]byte(data)); ok {
+			t.Errorf("DetectFormat of %q got %v", data, got)
+		}
+	}
+}
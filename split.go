@@ -0,0 +1,105 @@
+package senml
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Split breaks a pack into packs whose encoding in the given format takes at
+// most maxBytes. The records keep their order and form. The first record of
+// each pack gets the base fields in effect at that point, so each pack can be
+// resolved on its own.
+func Split(s SenML, format Format, maxBytes int) ([]SenML, error) {
+	var ret []SenML
+
+	if maxBytes <= 0 {
+		return nil, errors.New("maxBytes must be positive")
+	}
+
+	bases := effectiveBases(s.Records)
+	size := func(start int, n int) (int, error) {
+		data, err := Encode(chunk(s, bases, start, n), format, OutputOptions{})
+		return len(data), err
+	}
+
+	for start := 0; start < len(s.Records); {
+		n, err := size(start, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxBytes {
+			return nil, fmt.Errorf("record %d needs %d bytes, more than %d", start, n, maxBytes)
+		}
+
+		// the size grows with the records taken, so find the most that fit
+		// by doubling and then halving the step
+		fits, step := 1, 1
+		for start+fits < len(s.Records) {
+			next := fits + step
+			if start+next > len(s.Records) {
+				next = len(s.Records) - start
+			}
+			n, err = size(start, next)
+			if err != nil {
+				return nil, err
+			}
+			if n <= maxBytes {
+				fits = next
+				step *= 2
+			} else if step > 1 {
+				step /= 2
+			} else {
+				break
+			}
+		}
+
+		ret = append(ret, chunk(s, bases, start, fits))
+		start += fits
+	}
+
+	return ret, nil
+}
+
+// effectiveBases returns, for each record, a record holding the base fields in
+// effect for it
+func effectiveBases(records []SenMLRecord) []SenMLRecord {
+	var base SenMLRecord
+	bases := make([]SenMLRecord, len(records))
+
+	for i, r := range records {
+		if r.BaseName != "" {
+			base.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			base.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			base.BaseUnit = r.BaseUnit
+		}
+		if r.BaseVersion != 0 {
+			base.BaseVersion = r.BaseVersion
+		}
+		bases[i] = base
+	}
+
+	return bases
+}
+
+// chunk returns n records from start as a pack, with the base fields in
+// effect put on the first record
+func chunk(s SenML, bases []SenMLRecord, start int, n int) SenML {
+	var ret SenML
+	ret.XMLName = s.XMLName
+	ret.Xmlns = s.Xmlns
+
+	ret.Records = make([]SenMLRecord, n)
+	copy(ret.Records, s.Records[start:start+n])
+	first := &ret.Records[0]
+	base := bases[start]
+	first.BaseName = base.BaseName
+	first.BaseTime = base.BaseTime
+	first.BaseUnit = base.BaseUnit
+	first.BaseVersion = base.BaseVersion
+
+	return ret
+}
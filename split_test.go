@@ -0,0 +1,58 @@
+package senml_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestSplit(t *testing.T) {
+	var s senml.SenML
+	for i := 0; i < 50; i++ {
+		v := float64(i)
+		r := senml.SenMLRecord{Name: "sensor" + strconv.Itoa(i), Value: &v, Time: float64(i)}
+		switch i {
+		case 0:
+			r.BaseName = "urn:dev:mac:0024befffe804ff1/"
+			r.BaseTime = 1600000000
+			r.BaseUnit = "Cel"
+		case 20:
+			r.BaseName = "urn:dev:mac:0024befffe804ff2/"
+		}
+		s.Records = append(s.Records, r)
+	}
+	want := senml.Normalize(s)
+
+	for _, format := range []senml.Format{senml.JSON, senml.CBOR, senml.XML} {
+		chunks, err := senml.Split(s, format, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) < 2 {
+			t.Errorf("Split for format %d made %d packs", format, len(chunks))
+		}
+
+		var got []senml.SenMLRecord
+		for _, c := range chunks {
+			data, _ := senml.Encode(c, format, senml.OutputOptions{})
+			if len(data) > 200 {
+				t.Errorf("Split for format %d made a pack of %d bytes", format, len(data))
+			}
+			got = append(got, senml.Normalize(c).Records...)
+		}
+		if len(got) != len(want.Records) {
+			t.Fatalf("Split for format %d kept %d records", format, len(got))
+		}
+		for i := range got {
+			if got[i].Name != want.Records[i].Name || got[i].Time != want.Records[i].Time || got[i].Unit != "Cel" {
+				t.Errorf("Split record %d resolves to %v", i, got[i])
+			}
+		}
+	}
+
+	_, err := senml.Split(s, senml.JSON, 20)
+	if err == nil {
+		t.Error("Split with a limit below one record should fail")
+	}
+}
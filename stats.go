@@ -0,0 +1,110 @@
+package senml
+
+import (
+	"math"
+	"sort"
+)
+
+// SeriesStats summarizes the records with one resolved name
+type SeriesStats struct {
+	Name    string
+	Records int
+	// Kinds counts the records carrying each value field: v, vs, vb, vd and s
+	Kinds map[string]int
+	Units []string
+	Start float64
+	End   float64
+	// Values counts the finite numeric values, which Min, Max and Mean are
+	// over
+	Values int
+	Min    float64
+	Max    float64
+	Mean   float64
+
+	sum float64
+}
+
+// Stats summarizes the records of packs added to it, such as the batches of
+// a stream
+type Stats struct {
+	Records int
+	Start   float64
+	End     float64
+
+	series map[string]*SeriesStats
+}
+
+// NewStats returns Stats with no records added
+func NewStats() *Stats {
+	return &Stats{
+		Start:  math.Inf(1),
+		End:    math.Inf(-1),
+		series: map[string]*SeriesStats{},
+	}
+}
+
+// Add resolves the records of a pack and counts them in
+func (st *Stats) Add(s SenML) {
+	for _, r := range Normalize(s).Records {
+		st.Records += 1
+		st.Start = math.Min(st.Start, r.Time)
+		st.End = math.Max(st.End, r.Time)
+
+		ss, ok := st.series[r.Name]
+		if !ok {
+			ss = &SeriesStats{
+				Name:  r.Name,
+				Kinds: map[string]int{},
+				Start: math.Inf(1),
+				End:   math.Inf(-1),
+				Min:   math.Inf(1),
+				Max:   math.Inf(-1),
+			}
+			st.series[r.Name] = ss
+		}
+		ss.add(r)
+	}
+}
+
+func (ss *SeriesStats) add(r SenMLRecord) {
+	ss.Records += 1
+	ss.Start = math.Min(ss.Start, r.Time)
+	ss.End = math.Max(ss.End, r.Time)
+
+	for kind, test := range valueKinds {
+		if test(r) {
+			ss.Kinds[kind] += 1
+		}
+	}
+
+	if r.Unit != "" {
+		i := sort.SearchStrings(ss.Units, r.Unit)
+		if i == len(ss.Units) || ss.Units[i] != r.Unit {
+			ss.Units = append(ss.Units, "")
+			copy(ss.Units[i+1:], ss.Units[i:])
+			ss.Units[i] = r.Unit
+		}
+	}
+
+	if r.Value != nil && !math.IsInf(*r.Value, 0) && !math.IsNaN(*r.Value) {
+		ss.Values += 1
+		ss.Min = math.Min(ss.Min, *r.Value)
+		ss.Max = math.Max(ss.Max, *r.Value)
+		ss.sum += *r.Value
+		ss.Mean = ss.sum / float64(ss.Values)
+	}
+}
+
+// Series returns the summary of each name, sorted by name
+func (st *Stats) Series() []SeriesStats {
+	var ret []SeriesStats
+
+	for _, ss := range st.series {
+		ret = append(ret, *ss)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
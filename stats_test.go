@@ -0,0 +1,71 @@
+package senml_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cisco/senml"
+)
+
+func TestStats(t *testing.T) {
+	v1 := 20.0
+	v2 := 23.0
+	v3 := 26.0
+	yes := true
+	st := senml.NewStats()
+	st.Add(senml.SenML{Records: []senml.SenMLRecord{
+		{BaseName: "dev/", BaseTime: 1600000000, Name: "temp", Unit: "Cel", Value: &v1},
+		{Name: "door", BoolValue: &yes, Time: 5},
+	}})
+	st.Add(senml.SenML{Records: []senml.SenMLRecord{
+		{Name: "dev/temp", Unit: "K", Value: &v2, Time: 1600000010},
+		{Name: "dev/temp", Unit: "Cel", Value: &v3, Sum: &v3, Time: 1600000020},
+	}})
+
+	if st.Records != 4 || st.Start != 1600000000 || st.End != 1600000020 {
+		t.Error("Stats totals got", st.Records, st.Start, st.End)
+	}
+
+	series := st.Series()
+	if len(series) != 2 || series[0].Name != "dev/door" || series[1].Name != "dev/temp" {
+		t.Fatal("Stats series got", series)
+	}
+	door := series[0]
+	if door.Records != 1 || door.Kinds["vb"] != 1 || door.Values != 0 || len(door.Units) != 0 {
+		t.Error("Stats of door got", door)
+	}
+	temp := series[1]
+	if temp.Records != 3 || temp.Kinds["v"] != 3 || temp.Kinds["s"] != 1 {
+		t.Error("Stats of temp kinds got", temp)
+	}
+	if len(temp.Units) != 2 || temp.Units[0] != "Cel" || temp.Units[1] != "K" {
+		t.Error("Stats of temp units got", temp.Units)
+	}
+	if temp.Min != 20 || temp.Max != 26 || temp.Mean != 23 || temp.Start != 1600000000 || temp.End != 1600000020 {
+		t.Error("Stats of temp values got", temp)
+	}
+}
+
+func TestStatsSumOnly(t *testing.T) {
+	sum := 5.0
+	st := senml.NewStats()
+	st.Add(senml.SenML{Records: []senml.SenMLRecord{{Name: "s", Sum: &sum, Time: 1600000000}}})
+	series := st.Series()
+	if st.Records != 1 || len(series) != 1 || series[0].Kinds["s"] != 1 {
+		t.Error("Stats of a sum got", st.Records, series)
+	}
+}
+
+func TestStatsNotFinite(t *testing.T) {
+	values := []float64{1, math.NaN(), 3, math.Inf(1), math.Inf(-1)}
+	var s senml.SenML
+	for i := range values {
+		s.Records = append(s.Records, senml.SenMLRecord{Name: "a", Value: &values[i], Time: 1600000000 + float64(i)})
+	}
+	st := senml.NewStats()
+	st.Add(s)
+	a := st.Series()[0]
+	if a.Records != 5 || a.Kinds["v"] != 5 || a.Values != 2 || a.Min != 1 || a.Max != 3 || a.Mean != 2 {
+		t.Error("Stats with values not finite got", a)
+	}
+}
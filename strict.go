@@ -0,0 +1,365 @@
+package senml
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type valueKind int
+
+const (
+	otherValue valueKind = iota
+	textValue
+	numberValue
+	boolValue
+	bytesValue
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case textValue:
+		return "a string"
+	case numberValue:
+		return "a number"
+	case boolValue:
+		return "a boolean"
+	case bytesValue:
+		return "a byte string"
+	}
+	return "something else"
+}
+
+// fieldKinds gives the kind of value each field known to RFC 8428 holds
+var fieldKinds = map[string]valueKind{
+	"bn":   textValue,
+	"bt":   numberValue,
+	"bu":   textValue,
+	"bver": numberValue,
+	"l":    textValue,
+	"n":    textValue,
+	"u":    textValue,
+	"t":    numberValue,
+	"ut":   numberValue,
+	"v":    numberValue,
+	"vs":   textValue,
+	"vd":   textValue,
+	"vb":   boolValue,
+	"s":    numberValue,
+}
+
+var errTrailingData = errors.New("unexpected data after SenML pack")
+
+// strictChecker checks a message conforms to RFC 8428 before it is decoded
+type strictChecker struct {
+	extensions map[string]bool
+}
+
+func newStrictChecker(extensions []string) strictChecker {
+	c := strictChecker{extensions: map[string]bool{}}
+	for _, e := range extensions {
+		c.extensions[e] = true
+	}
+	return c
+}
+
+func (c strictChecker) check(msg []byte, format Format) error {
+	switch {
+	case format == JSON:
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+		return c.json(dec, true)
+
+	case format == XML:
+		return c.xml(msg)
+
+	case format == CBOR:
+		it, n, err := readCBOR(msg)
+		if err != nil {
+			return err
+		}
+		if n != len(msg) {
+			return errTrailingData
+		}
+		return c.items(it, format)
+
+	case format == MPACK:
+		it, n, err := readMsgpack(msg)
+		if err != nil {
+			return err
+		}
+		if n != len(msg) {
+			return errTrailingData
+		}
+		return c.items(it, format)
+	}
+
+	return nil
+}
+
+// field checks one field of a record, seen holds the fields already found
+func (c strictChecker) field(name string, kind valueKind, seen map[string]bool) error {
+	if seen[name] {
+		return fmt.Errorf("duplicate field %q", name)
+	}
+	seen[name] = true
+
+	want, known := fieldKinds[name]
+	if !known {
+		if c.extensions[name] {
+			return nil
+		}
+		if strings.HasSuffix(name, "_") {
+			return fmt.Errorf("unknown must-understand field %q", name)
+		}
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if kind != want && !(name == "vd" && kind == bytesValue) {
+		return fmt.Errorf("field %q must be %v", name, want)
+	}
+
+	return nil
+}
+
+// json checks a JSON array of records, or a single record when pack is false
+func (c strictChecker) json(dec *json.Decoder, pack bool) error {
+	if pack {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != json.Delim('[') {
+			return errors.New("SenML pack is not an array")
+		}
+		for i := 0; dec.More(); i++ {
+			err = c.jsonRecord(dec)
+			if err != nil {
+				return fmt.Errorf("SenML record %d: %v", i, err)
+			}
+		}
+		_, err = dec.Token()
+		if err != nil {
+			return err
+		}
+	} else {
+		err := c.jsonRecord(dec)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+	if err != io.EOF {
+		return errTrailingData
+	}
+
+	return nil
+}
+
+func (c strictChecker) jsonRecord(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return errors.New("record is not an object")
+	}
+
+	seen := map[string]bool{}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := tok.(string)
+
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		kind := otherValue
+		switch tok.(type) {
+		case string:
+			kind = textValue
+		case json.Number:
+			kind = numberValue
+		case bool:
+			kind = boolValue
+		case json.Delim:
+			err = skipJSON(dec)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = c.field(name, kind, seen)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+
+	return err
+}
+
+// skipJSON skips the rest of an array or object whose opening delimiter has
+// been read
+func skipJSON(dec *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			depth += 1
+		case json.Delim(']'), json.Delim('}'):
+			depth -= 1
+		}
+	}
+	return nil
+}
+
+func (c strictChecker) xml(msg []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(msg))
+	depth := 0
+	ended := false
+	index := 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if ended {
+				return errTrailingData
+			}
+			depth += 1
+			if depth == 1 {
+				if t.Name.Local != "sensml" {
+					return fmt.Errorf("unexpected root element <%s>", t.Name.Local)
+				}
+				continue
+			}
+			if depth > 2 || t.Name.Local != "senml" {
+				return fmt.Errorf("unexpected element <%s>", t.Name.Local)
+			}
+
+			seen := map[string]bool{}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				err = c.field(a.Name.Local, xmlKind(a.Name.Local, a.Value), seen)
+				if err != nil {
+					return fmt.Errorf("SenML record %d: %v", index, err)
+				}
+			}
+			index += 1
+
+		case xml.EndElement:
+			depth -= 1
+			if depth == 0 {
+				ended = true
+			}
+
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				if ended {
+					return errTrailingData
+				}
+				return errors.New("unexpected text in SenML pack")
+			}
+		}
+	}
+	if !ended {
+		return errors.New("SenML pack has no <sensml> element")
+	}
+
+	return nil
+}
+
+// xmlKind works out the kind of value an XML attribute holds for the field
+func xmlKind(name string, value string) valueKind {
+	switch fieldKinds[name] {
+	case numberValue:
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return numberValue
+		}
+	case boolValue:
+		if _, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return textValue
+}
+
+// items checks a CBOR or MessagePack pack
+func (c strictChecker) items(pack item, format Format) error {
+	if pack.kind != arrayItem {
+		return errors.New("SenML pack is not an array")
+	}
+
+	for i, r := range pack.items {
+		err := c.itemRecord(r, format)
+		if err != nil {
+			return fmt.Errorf("SenML record %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c strictChecker) itemRecord(r item, format Format) error {
+	if r.kind != mapItem {
+		return errors.New("record is not a map")
+	}
+
+	seen := map[string]bool{}
+	for j := 0; j < len(r.items); j += 2 {
+		key, value := r.items[j], r.items[j+1]
+
+		name, isText := key.text()
+		if label, isInt := key.int(); isInt && format == CBOR {
+			var known bool
+			name, known = labels[int(label)]
+			if !known {
+				return fmt.Errorf("unknown label %d", label)
+			}
+		} else if !isText {
+			return errors.New("field name is not a string")
+		} else if _, known := fieldKinds[name]; known && format == CBOR {
+			return fmt.Errorf("field %q must use its CBOR label", name)
+		}
+
+		kind := otherValue
+		switch {
+		case value.kind == textItem:
+			kind = textValue
+		case value.kind == bytesItem:
+			kind = bytesValue
+		case value.isNumber():
+			kind = numberValue
+		case value.isBool():
+			kind = boolValue
+		}
+
+		err := c.field(name, kind, seen)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package senml
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// writeCSV writes rows with CRLF line ends. When aligned is set each field is
+// padded so the columns line up.
+func writeCSV(rows [][]string, aligned bool) []byte {
+	var buf bytes.Buffer
+	var widths []int
+
+	if aligned {
+		widths = columnWidths(rows)
+	}
+	for _, row := range rows {
+		for i, field := range row {
+			buf.WriteString(field)
+			if i < len(row)-1 {
+				buf.WriteString(",")
+				if aligned {
+					pad(&buf, widths[i]-utf8.RuneCountInString(field)+1)
+				}
+			}
+		}
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+}
+
+func columnWidths(rows [][]string) []int {
+	var widths []int
+	for _, row := range rows {
+		for i, field := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(field); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	return widths
+}
+
+func pad(buf *bytes.Buffer, n int) {
+	for ; n > 0; n-- {
+		buf.WriteByte(' ')
+	}
+}
+
+// tableColumns lists the fields a table can show, in the order shown
+var tableColumns = []struct {
+	name    string
+	numeric bool
+	cell    func(r SenMLRecord) string
+}{
+	{"bn", false, func(r SenMLRecord) string { return r.BaseName }},
+	{"bt", true, func(r SenMLRecord) string { return formatNumber(r.BaseTime) }},
+	{"bu", false, func(r SenMLRecord) string { return r.BaseUnit }},
+	{"bver", true, func(r SenMLRecord) string { return formatInt(r.BaseVersion) }},
+	{"n", false, func(r SenMLRecord) string { return r.Name }},
+	{"u", false, func(r SenMLRecord) string { return r.Unit }},
+	{"t", true, func(r SenMLRecord) string { return formatNumber(r.Time) }},
+	{"ut", true, func(r SenMLRecord) string { return formatNumber(r.UpdateTime) }},
+	{"v", true, func(r SenMLRecord) string { return formatPointer(r.Value) }},
+	{"vs", false, func(r SenMLRecord) string { return r.StringValue }},
+	{"vb", false, func(r SenMLRecord) string {
+		if r.BoolValue == nil {
+			return ""
+		}
+		return strconv.FormatBool(*r.BoolValue)
+	}},
+	{"vd", false, func(r SenMLRecord) string { return r.DataValue }},
+	{"s", true, func(r SenMLRecord) string { return formatPointer(r.Sum) }},
+	{"l", false, func(r SenMLRecord) string { return r.Link }},
+}
+
+func formatNumber(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+func formatPointer(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+// writeTable lays the records out as a table with a column for each field
+// used by any of them. Numbers are right aligned.
+func writeTable(records []SenMLRecord) []byte {
+	var buf bytes.Buffer
+
+	var columns []int
+	var rows [][]string
+	for c, column := range tableColumns {
+		used := false
+		for _, r := range records {
+			if column.cell(r) != "" {
+				used = true
+				break
+			}
+		}
+		if used {
+			columns = append(columns, c)
+		}
+	}
+
+	header := make([]string, len(columns))
+	rule := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = tableColumns[c].name
+	}
+	rows = append(rows, header, rule)
+	for _, r := range records {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = tableColumns[c].cell(r)
+		}
+		rows = append(rows, row)
+	}
+
+	widths := columnWidths(rows)
+	for i := range rule {
+		rule[i] = string(bytes.Repeat([]byte("-"), widths[i]))
+	}
+
+	var line bytes.Buffer
+	for _, row := range rows {
+		line.Reset()
+		for i, cell := range row {
+			gap := widths[i] - utf8.RuneCountInString(cell)
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			if tableColumns[columns[i]].numeric {
+				pad(&line, gap)
+				line.WriteString(cell)
+			} else {
+				line.WriteString(cell)
+				pad(&line, gap)
+			}
+		}
+		buf.Write(bytes.TrimRight(line.Bytes(), " "))
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
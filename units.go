@@ -0,0 +1,128 @@
+package senml
+
+// Unit is an entry in the SenML units registry of RFC 8428, or the secondary
+// units registry of RFC 8798
+type Unit struct {
+	Symbol      string
+	Description string
+	// Discouraged units are kept for old producers; RFC 8428 says new
+	// producers should not use them
+	Discouraged bool
+	// Secondary units are a scaled form of a unit in the main registry
+	Secondary bool
+}
+
+var units = map[string]Unit{}
+
+func init() {
+	for _, u := range []Unit{
+		{"m", "meter", false, false},
+		{"kg", "kilogram", false, false},
+		{"g", "gram", true, false},
+		{"s", "second", false, false},
+		{"A", "ampere", false, false},
+		{"K", "kelvin", false, false},
+		{"cd", "candela", false, false},
+		{"mol", "mole", false, false},
+		{"Hz", "hertz", false, false},
+		{"rad", "radian", false, false},
+		{"sr", "steradian", false, false},
+		{"N", "newton", false, false},
+		{"Pa", "pascal", false, false},
+		{"J", "joule", false, false},
+		{"W", "watt", false, false},
+		{"C", "coulomb", false, false},
+		{"V", "volt", false, false},
+		{"F", "farad", false, false},
+		{"Ohm", "ohm", false, false},
+		{"S", "siemens", false, false},
+		{"Wb", "weber", false, false},
+		{"T", "tesla", false, false},
+		{"H", "henry", false, false},
+		{"Cel", "degrees Celsius", false, false},
+		{"lm", "lumen", false, false},
+		{"lx", "lux", false, false},
+		{"Bq", "becquerel", false, false},
+		{"Gy", "gray", false, false},
+		{"Sv", "sievert", false, false},
+		{"kat", "katal", false, false},
+		{"m2", "square meter", false, false},
+		{"m3", "cubic meter", false, false},
+		{"l", "liter", true, false},
+		{"m/s", "meter per second", false, false},
+		{"m/s2", "meter per square second", false, false},
+		{"m3/s", "cubic meter per second", false, false},
+		{"l/s", "liter per second", true, false},
+		{"W/m2", "watt per square meter", false, false},
+		{"cd/m2", "candela per square meter", false, false},
+		{"bit", "bit", false, false},
+		{"bit/s", "bit per second", false, false},
+		{"lat", "degrees latitude", false, false},
+		{"lon", "degrees longitude", false, false},
+		{"pH", "pH value", false, false},
+		{"dB", "decibel", false, false},
+		{"dBW", "decibel relative to 1 W", false, false},
+		{"Bspl", "bel of sound pressure level", true, false},
+		{"count", "counter value", false, false},
+		{"/", "ratio", false, false},
+		{"%", "ratio in percent", true, false},
+		{"%RH", "percentage of relative humidity", false, false},
+		{"%EL", "percentage of battery energy left", false, false},
+		{"EL", "seconds of battery energy left", false, false},
+		{"1/s", "events per second", false, false},
+		{"1/min", "events per minute", true, false},
+		{"beat/min", "heart beats per minute", true, false},
+		{"beats", "heart beats", true, false},
+		{"S/m", "siemens per meter", false, false},
+		{"B", "byte", false, false},
+		{"VA", "volt-ampere", false, false},
+		{"VAs", "volt-ampere second", false, false},
+		{"var", "volt-ampere reactive", false, false},
+		{"vars", "volt-ampere reactive second", false, false},
+		{"J/m", "joule per meter", false, false},
+		{"kg/m3", "kilogram per cubic meter", false, false},
+		{"deg", "degree of angle", true, false},
+
+		{"ms", "millisecond", false, true},
+		{"min", "minute", false, true},
+		{"h", "hour", false, true},
+		{"MHz", "megahertz", false, true},
+		{"kW", "kilowatt", false, true},
+		{"kVA", "kilovolt-ampere", false, true},
+		{"kvar", "kilovar", false, true},
+		{"Ah", "ampere-hour", false, true},
+		{"Wh", "watt-hour", false, true},
+		{"kWh", "kilowatt-hour", false, true},
+		{"varh", "var-hour", false, true},
+		{"kvarh", "kilovar-hour", false, true},
+		{"kVAh", "kilovolt-ampere-hour", false, true},
+		{"Wh/km", "watt-hour per kilometer", false, true},
+		{"KiB", "kibibyte", false, true},
+		{"GB", "gigabyte", false, true},
+		{"Mbit/s", "megabit per second", false, true},
+		{"B/s", "byte per second", false, true},
+		{"MB/s", "megabyte per second", false, true},
+		{"mV", "millivolt", false, true},
+		{"mA", "milliampere", false, true},
+		{"dBm", "decibel relative to 1 mW", false, true},
+		{"ug/m3", "microgram per cubic meter", false, true},
+		{"mm/h", "millimeter per hour", false, true},
+		{"m/h", "meter per hour", false, true},
+		{"ppm", "parts per million", false, true},
+		{"/100", "percent", false, true},
+		{"/1000", "per mille", false, true},
+		{"hPa", "hectopascal", false, true},
+		{"mm", "millimeter", false, true},
+		{"cm", "centimeter", false, true},
+		{"km", "kilometer", false, true},
+		{"km/h", "kilometer per hour", false, true},
+	} {
+		units[u.Symbol] = u
+	}
+}
+
+// LookupUnit finds a unit symbol in the registries
+func LookupUnit(symbol string) (Unit, bool) {
+	u, ok := units[symbol]
+	return u, ok
+}